@@ -0,0 +1,262 @@
+package collector
+
+import (
+	"database/sql"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	logger "github.com/prometheus/common/log"
+)
+
+/**
+ *  存储类型及AO表压缩信息抓取器
+ *  按数据库统计heap/AO行存/AO列存/外部表的表数量与存储大小、各压缩类型与级别的分布，以及最大的若干张AO表的压缩比；
+ *  Greenplum 7起pg_class不再提供relstorage，存储类型由表访问方法决定，压缩选项保存在reloptions中，外部表为外部数据表
+ */
+
+const (
+	storageTypeSql = `
+		SELECT CASE c.relstorage
+				WHEN 'h' THEN 'heap'
+				WHEN 'a' THEN 'ao_row'
+				WHEN 'c' THEN 'ao_column'
+				WHEN 'x' THEN 'external'
+				ELSE 'other'
+			END storage_type
+			 , count(*)
+			 , coalesce(sum(CASE WHEN c.relstorage IN ('h','a','c') THEN pg_relation_size(c.oid) ELSE 0 END),0)
+		  FROM pg_class c
+		  JOIN pg_namespace n ON c.relnamespace=n.oid
+		WHERE c.relkind='r'
+		AND n.nspname NOT IN ('pg_catalog','information_schema','gp_toolkit','pg_aoseg','pg_bitmapindex')
+		AND n.nspname NOT LIKE 'pg_toast%'
+		AND n.nspname NOT LIKE 'pg_temp%'
+		GROUP BY 1
+		`
+	compressionTypeSql = `
+		SELECT CASE WHEN a.columnstore THEN 'ao_column' ELSE 'ao_row' END storage_type
+			 , coalesce(nullif(a.compresstype,''),'none') compress_type
+			 , a.compresslevel
+			 , count(*)
+			 , coalesce(sum(pg_relation_size(c.oid)),0)
+		  FROM pg_appendonly a
+		  JOIN pg_class c ON a.relid=c.oid
+		  JOIN pg_namespace n ON c.relnamespace=n.oid
+		WHERE c.relkind='r'
+		AND n.nspname NOT LIKE 'pg_temp%'
+		GROUP BY 1,2,3
+		`
+	storageTypeSql_V7 = `
+		SELECT CASE
+				WHEN c.relkind='f' THEN 'external'
+				WHEN am.amname IN ('heap','ao_row','ao_column') THEN am.amname
+				ELSE 'other'
+			END storage_type
+			 , count(*)
+			 , coalesce(sum(CASE WHEN c.relkind='r' THEN pg_relation_size(c.oid) ELSE 0 END),0)
+		  FROM pg_class c
+		  JOIN pg_namespace n ON c.relnamespace=n.oid
+		  LEFT JOIN pg_am am ON c.relam=am.oid
+		WHERE c.relkind IN ('r','f')
+		AND n.nspname NOT IN ('pg_catalog','information_schema','gp_toolkit','pg_aoseg','pg_bitmapindex')
+		AND n.nspname NOT LIKE 'pg_toast%'
+		AND n.nspname NOT LIKE 'pg_temp%'
+		GROUP BY 1
+		`
+	compressionTypeSql_V7 = `
+		SELECT am.amname storage_type
+			 , coalesce((SELECT nullif(split_part(o,'=',2),'') FROM unnest(c.reloptions) o WHERE o LIKE 'compresstype=%'),'none') compress_type
+			 , coalesce((SELECT split_part(o,'=',2)::int FROM unnest(c.reloptions) o WHERE o LIKE 'compresslevel=%'),0) compress_level
+			 , count(*)
+			 , coalesce(sum(pg_relation_size(c.oid)),0)
+		  FROM pg_appendonly a
+		  JOIN pg_class c ON a.relid=c.oid
+		  JOIN pg_am am ON c.relam=am.oid
+		  JOIN pg_namespace n ON c.relnamespace=n.oid
+		WHERE c.relkind='r'
+		AND n.nspname NOT LIKE 'pg_temp%'
+		GROUP BY 1,2,3
+		`
+	aoCompressionRatioSql = `
+		SELECT nspname, relname, get_ao_compression_ratio(oid)
+		  FROM (
+			SELECT c.oid, n.nspname, c.relname
+			  FROM pg_appendonly a
+			  JOIN pg_class c ON a.relid=c.oid
+			  JOIN pg_namespace n ON c.relnamespace=n.oid
+			WHERE c.relkind='r'
+			AND n.nspname NOT LIKE 'pg_temp%'
+			ORDER BY pg_relation_size(c.oid) DESC
+			LIMIT $1
+		) t
+		`
+)
+
+var (
+	storageTablesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemServer, "database_storage_tables"),
+		"Number of user tables of each storage type in each database",
+		[]string{"dbname", "storage_type"},
+		nil,
+	)
+
+	storageBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemServer, "database_storage_bytes"),
+		"Total bytes of user tables of each storage type in each database",
+		[]string{"dbname", "storage_type"},
+		nil,
+	)
+
+	compressionTablesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemServer, "database_compression_tables"),
+		"Number of append-optimized tables of each compression type and level in each database",
+		[]string{"dbname", "storage_type", "compress_type", "compress_level"},
+		nil,
+	)
+
+	compressionBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemServer, "database_compression_bytes"),
+		"Total bytes of append-optimized tables of each compression type and level in each database",
+		[]string{"dbname", "storage_type", "compress_type", "compress_level"},
+		nil,
+	)
+
+	aoCompressionRatioDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemServer, "database_ao_table_compression_ratio"),
+		"Compression ratio of the largest append-optimized tables in each database",
+		[]string{"dbname", "schema", "table"},
+		nil,
+	)
+)
+
+func NewAoStorageScraper(topN int) Scraper {
+	return aoStorageScraper{topN: topN}
+}
+
+type aoStorageScraper struct {
+	topN int
+}
+
+func (aoStorageScraper) Name() string {
+	return "ao_storage_scraper"
+}
+
+func (aoStorageScraper) Requirements(ver int) Requirements {
+	return Requirements{Relations: []string{"pg_catalog.pg_appendonly"}, Functions: []string{"pg_catalog.get_ao_compression_ratio"}}
+}
+
+func (s aoStorageScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
+	return scrapeEachDatabase(db, func(dbname string, conn *sql.DB) error {
+		errS := scrapeStorageType(conn, dbname, ch, ver)
+		errC := scrapeCompressionType(conn, dbname, ch, ver)
+		errR := scrapeAoCompressionRatio(conn, dbname, s.topN, ch)
+
+		return combineErr(errS, errC, errR)
+	})
+}
+
+func scrapeStorageType(conn *sql.DB, dbname string, ch chan<- prometheus.Metric, ver int) error {
+	querySql := storageTypeSql
+	if ver >= verGP7 {
+		querySql = storageTypeSql_V7
+	}
+
+	rows, err := conn.Query(querySql)
+	logger.Infof("Query Database: %s", querySql)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	errs := make([]error, 0)
+
+	for rows.Next() {
+		var storageType string
+		var count, size float64
+
+		err = rows.Scan(&storageType, &count, &size)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(storageTablesDesc, prometheus.GaugeValue, count, dbname, storageType)
+		ch <- prometheus.MustNewConstMetric(storageBytesDesc, prometheus.GaugeValue, size, dbname, storageType)
+	}
+
+	return combineErr(errs...)
+}
+
+func scrapeCompressionType(conn *sql.DB, dbname string, ch chan<- prometheus.Metric, ver int) error {
+	querySql := compressionTypeSql
+	if ver >= verGP7 {
+		querySql = compressionTypeSql_V7
+	}
+
+	rows, err := conn.Query(querySql)
+	logger.Infof("Query Database: %s", querySql)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	errs := make([]error, 0)
+
+	for rows.Next() {
+		var storageType, compressType string
+		var compressLevel int
+		var count, size float64
+
+		err = rows.Scan(&storageType, &compressType, &compressLevel, &count, &size)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		level := strconv.Itoa(compressLevel)
+		ch <- prometheus.MustNewConstMetric(compressionTablesDesc, prometheus.GaugeValue, count, dbname, storageType, compressType, level)
+		ch <- prometheus.MustNewConstMetric(compressionBytesDesc, prometheus.GaugeValue, size, dbname, storageType, compressType, level)
+	}
+
+	return combineErr(errs...)
+}
+
+func scrapeAoCompressionRatio(conn *sql.DB, dbname string, topN int, ch chan<- prometheus.Metric) error {
+	if topN <= 0 {
+		return nil
+	}
+
+	rows, err := conn.Query(aoCompressionRatioSql, topN)
+	logger.Infof("Query Database: %s", aoCompressionRatioSql)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	errs := make([]error, 0)
+
+	for rows.Next() {
+		var schema, table string
+		var ratio sql.NullFloat64
+
+		err = rows.Scan(&schema, &table, &ratio)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if !ratio.Valid {
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(aoCompressionRatioDesc, prometheus.GaugeValue, ratio.Float64, dbname, schema, table)
+	}
+
+	return combineErr(errs...)
+}
@@ -0,0 +1,291 @@
+package collector
+
+import (
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+	logger "github.com/prometheus/common/log"
+)
+
+/**
+ *  活动会话历史(ASH)采样器
+ *  在两次抓取之间按固定间隔在后台采样pg_stat_activity中的非空闲会话，每个被采样的会话计入一个采样间隔的时长，
+ *  累计为按数据库、用户、会话状态、等待原因划分的会话秒数，以及按归一化SQL指纹划分、采样时长最多的若干条SQL；
+ *  为限制内存而不再跟踪的SQL指纹，其累计时长计入指纹为other的序列，使各序列的总和单调递增
+ */
+
+const (
+	ashSampleSql_V6 = `
+		SELECT coalesce(datname,''), coalesce(usename,''), coalesce(state,'')
+			 , CASE WHEN waiting THEN coalesce(waiting_reason,'') ELSE '' END
+			 , coalesce(query,'')
+		  FROM pg_stat_activity
+		WHERE pid <> pg_backend_pid()
+		AND state <> 'idle'
+		`
+	ashSampleSql_V7 = `
+		SELECT coalesce(datname,''), coalesce(usename,''), coalesce(state,'')
+			 , CASE WHEN state='active' THEN lower(coalesce(wait_event_type,'')) ELSE '' END
+			 , coalesce(query,'')
+		  FROM pg_stat_activity
+		WHERE pid <> pg_backend_pid()
+		AND backend_type='client backend'
+		AND state <> 'idle'
+		`
+	ashSampleSql_V5 = `
+		SELECT coalesce(datname,''), coalesce(usename,'')
+			 , CASE WHEN current_query='<IDLE> in transaction' THEN 'idle in transaction'
+					WHEN current_query='<IDLE> in transaction (aborted)' THEN 'idle in transaction (aborted)'
+					WHEN current_query='<FASTPATH> function call' THEN 'fastpath function call'
+					ELSE 'active' END
+			 , CASE WHEN waiting THEN 'lock' ELSE '' END
+			 , CASE WHEN current_query LIKE '<%>%' THEN '' ELSE current_query END
+		  FROM pg_stat_activity
+		WHERE procpid <> pg_backend_pid()
+		AND current_query <> '<IDLE>'
+		`
+)
+
+// 归一化后保留的SQL文本字符数
+const ashQueryTextLength = 200
+
+// 不再跟踪的SQL指纹的累计时长所在序列的指纹
+const ashOtherFingerprint = "other"
+
+var (
+	ashStringLiteral  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	ashNumericLiteral = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+	ashWhitespace     = regexp.MustCompile(`\s+`)
+
+	ashQuerySecondsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemCluster, "ash_query_seconds_total"),
+		"Sampled active session seconds of the normalized queries with the most sampled time, seconds of queries no longer tracked are accumulated into fingerprint other",
+		[]string{"fingerprint", "query"}, nil,
+	)
+)
+
+type ashQuery struct {
+	text    string
+	seconds float64
+}
+
+func NewAshScraper(interval time.Duration, topN int) Scraper {
+	return &ashScraper{
+		interval: interval,
+		topN:     topN,
+		queries:  make(map[string]*ashQuery),
+		sessionSeconds: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subSystemCluster,
+			Name:      "ash_session_seconds_total",
+			Help:      "Sampled active session seconds by database, user, state and waiting reason",
+		}, []string{"dbname", "usename", "state", "waiting_reason"}),
+		samples: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subSystemCluster,
+			Name:      "ash_samples_total",
+			Help:      "Number of successful samples of pg_stat_activity taken by the background sampler",
+		}),
+	}
+}
+
+type ashScraper struct {
+	interval time.Duration
+	topN     int
+
+	mu             sync.Mutex
+	queries        map[string]*ashQuery
+	otherSeconds   float64
+	sessionSeconds *prometheus.CounterVec
+	samples        prometheus.Counter
+}
+
+func (*ashScraper) Name() string {
+	return "ash_scraper"
+}
+
+func (*ashScraper) Requirements(ver int) Requirements {
+	return Requirements{AllStats: true}
+}
+
+func (s *ashScraper) Interval() time.Duration {
+	return s.interval
+}
+
+func (s *ashScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessionSeconds.Collect(ch)
+	s.samples.Collect(ch)
+
+	for _, fingerprint := range s.topQueries(s.topN) {
+		q := s.queries[fingerprint]
+		ch <- prometheus.MustNewConstMetric(ashQuerySecondsDesc, prometheus.CounterValue, q.seconds, fingerprint, q.text)
+	}
+
+	if s.otherSeconds > 0 {
+		ch <- prometheus.MustNewConstMetric(ashQuerySecondsDesc, prometheus.CounterValue, s.otherSeconds, ashOtherFingerprint, "")
+	}
+
+	return nil
+}
+
+func (s *ashScraper) Sample(db *sql.DB, ver int) error {
+	querySql := ashSampleSql_V6
+	if ver >= verGP7 {
+		querySql = ashSampleSql_V7
+	} else if ver < verGP6 {
+		querySql = ashSampleSql_V5
+	}
+
+	rows, err := db.Query(querySql)
+	logger.Debugf("Query Database: %s", querySql)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	errs := make([]error, 0)
+
+	seconds := s.interval.Seconds()
+	for rows.Next() {
+		var dbname, usename, state, waitingReason, query string
+
+		err = rows.Scan(&dbname, &usename, &state, &waitingReason, &query)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		s.sessionSeconds.WithLabelValues(dbname, usename, state, waitingReason).Add(seconds)
+
+		if query == "" {
+			continue
+		}
+
+		text := normalizeQuery(query)
+		fingerprint := queryFingerprint(text)
+		if q, ok := s.queries[fingerprint]; ok {
+			q.seconds += seconds
+		} else {
+			s.queries[fingerprint] = &ashQuery{text: text, seconds: seconds}
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	s.pruneQueries()
+	s.samples.Inc()
+
+	return combineErr(errs...)
+}
+
+/**
+* 函数：topQueries
+* 功能：返回累计采样时长最多的n个SQL指纹，时长相同时按指纹排序以保证结果稳定
+ */
+func (s *ashScraper) topQueries(n int) []string {
+	fingerprints := make([]string, 0, len(s.queries))
+	for fingerprint := range s.queries {
+		fingerprints = append(fingerprints, fingerprint)
+	}
+
+	sort.Slice(fingerprints, func(i, j int) bool {
+		a, b := s.queries[fingerprints[i]], s.queries[fingerprints[j]]
+		if a.seconds != b.seconds {
+			return a.seconds > b.seconds
+		}
+
+		return fingerprints[i] < fingerprints[j]
+	})
+
+	if n < 0 {
+		n = 0
+	}
+
+	if len(fingerprints) > n {
+		fingerprints = fingerprints[:n]
+	}
+
+	return fingerprints
+}
+
+/**
+* 函数：pruneQueries
+* 功能：跟踪的SQL指纹超过topN的10倍时，只保留累计采样时长最多的topN的5倍，限制内存占用，
+*      其余指纹的累计时长计入other，避免输出的时长总和回退
+ */
+func (s *ashScraper) pruneQueries() {
+	if len(s.queries) <= s.topN*10 {
+		return
+	}
+
+	kept := s.topQueries(s.topN * 5)
+
+	queries := make(map[string]*ashQuery, len(kept))
+	for _, fingerprint := range kept {
+		queries[fingerprint] = s.queries[fingerprint]
+		delete(s.queries, fingerprint)
+	}
+
+	for _, q := range s.queries {
+		s.otherSeconds += q.seconds
+	}
+
+	s.queries = queries
+}
+
+/**
+* 函数：normalizeQuery
+* 功能：将SQL中的字符串与数值常量替换为?并合并空白，按字符截断为固定长度
+ */
+func normalizeQuery(query string) string {
+	text := strings.ToValidUTF8(query, "?")
+	text = ashStringLiteral.ReplaceAllString(text, "?")
+	text = ashNumericLiteral.ReplaceAllString(text, "?")
+	text = strings.TrimSpace(ashWhitespace.ReplaceAllString(text, " "))
+
+	return queryLabel(text, ashQueryTextLength)
+}
+
+/**
+* 函数：queryLabel
+* 功能：将SQL文本中不合法的UTF-8字节替换为?，并按字符截断为指定长度
+*      SQL_ASCII编码的数据库可能返回任意字节，标签值须为合法的UTF-8，否则输出指标时panic
+ */
+func queryLabel(text string, length int) string {
+	text = strings.ToValidUTF8(text, "?")
+
+	if utf8.RuneCountInString(text) > length {
+		text = string([]rune(text)[:length])
+	}
+
+	return text
+}
+
+/**
+* 函数：queryFingerprint
+* 功能：计算归一化SQL的指纹
+ */
+func queryFingerprint(text string) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(text))
+
+	return fmt.Sprintf("%016x", h.Sum64())
+}
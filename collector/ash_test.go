@@ -0,0 +1,112 @@
+package collector
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestNormalizeQuery(t *testing.T) {
+	longChinese := "select * from t where c = 1 -- " + strings.Repeat("中文注释", 100)
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "select * from t where id = 42 and name = 'bob'", want: "select * from t where id = ? and name = ?"},
+		{query: "SELECT  1.5,\n\t'it''s'  ", want: "SELECT ?, ?"},
+		{query: "select col1 from t2", want: "select col1 from t2"},
+		{query: "select '中文' from 表", want: "select ? from 表"},
+		{query: "select 'a\xff\xfeb' from t", want: "select ? from t"},
+		{query: "select \xff from t", want: "select ? from t"},
+		{query: longChinese, want: string([]rune("select * from t where c = ? -- " + strings.Repeat("中文注释", 100))[:ashQueryTextLength])},
+		{query: "", want: ""},
+	}
+
+	for _, test := range tests {
+		got := normalizeQuery(test.query)
+		if got != test.want {
+			t.Errorf("normalizeQuery(%q) = %q, want %q", test.query, got, test.want)
+		}
+
+		if !utf8.ValidString(got) || utf8.RuneCountInString(got) > ashQueryTextLength {
+			t.Errorf("normalizeQuery(%q) = %q is not valid UTF-8 within %d characters", test.query, got, ashQueryTextLength)
+		}
+
+		// 标签值不是合法的UTF-8时会panic
+		prometheus.MustNewConstMetric(ashQuerySecondsDesc, prometheus.CounterValue, 1, queryFingerprint(got), got)
+	}
+}
+
+func TestTopQueries(t *testing.T) {
+	s := NewAshScraper(0, 0).(*ashScraper)
+	s.queries = map[string]*ashQuery{
+		"c": {seconds: 1},
+		"a": {seconds: 5},
+		"b": {seconds: 5},
+		"d": {seconds: 9},
+	}
+
+	tests := []struct {
+		n    int
+		want []string
+	}{
+		{n: 1, want: []string{"d"}},
+		{n: 3, want: []string{"d", "a", "b"}},
+		{n: 10, want: []string{"d", "a", "b", "c"}},
+		{n: 0, want: []string{}},
+		{n: -1, want: []string{}},
+	}
+
+	for _, test := range tests {
+		if got := s.topQueries(test.n); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("topQueries(%d) = %v, want %v", test.n, got, test.want)
+		}
+	}
+}
+
+func TestPruneQueries(t *testing.T) {
+	s := NewAshScraper(0, 1).(*ashScraper)
+	for i := 0; i < 11; i++ {
+		s.queries[string(rune('a'+i))] = &ashQuery{seconds: float64(i)}
+	}
+
+	s.pruneQueries()
+
+	if len(s.queries) != 5 || s.queries["k"] == nil || s.queries["a"] != nil {
+		t.Errorf("pruneQueries kept %d queries, want the 5 with the most time", len(s.queries))
+	}
+
+	// 0+1+...+5
+	if s.otherSeconds != 15 {
+		t.Errorf("otherSeconds = %v, want 15", s.otherSeconds)
+	}
+
+	ch := make(chan prometheus.Metric, 10)
+	if err := s.Scrape(nil, ch, verGP6); err != nil {
+		t.Fatal(err)
+	}
+	close(ch)
+
+	var other bool
+	for metric := range ch {
+		if strings.Contains(metric.Desc().String(), "ash_query_seconds_total") {
+			var m dto.Metric
+			if err := metric.Write(&m); err != nil {
+				t.Fatal(err)
+			}
+
+			if m.GetLabel()[0].GetValue() == ashOtherFingerprint {
+				other = m.GetCounter().GetValue() == 15
+			}
+		}
+	}
+
+	if !other {
+		t.Error("evicted seconds are not reported as fingerprint other")
+	}
+}
@@ -0,0 +1,471 @@
+package collector
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	logger "github.com/prometheus/common/log"
+	"gopkg.in/yaml.v2"
+
+	// 纯Go实现的SQLite驱动，不依赖cgo
+	_ "modernc.org/sqlite"
+)
+
+/**
+ *  gpbackup备份历史抓取器
+ *  读取gpbackup生成的gpbackup_history.yaml或gpbackup_history.db文件，或导入到数据库中的备份历史表（列名与gpbackup_history.db中的backups表一致），
+ *  按数据库输出最近一次成功备份的时间、大小，以及最近一次备份的耗时、状态与类型
+ *  备份大小须包含master与所有primary segment上的备份文件，无法读取全部segment的备份文件时不输出，而不是输出不完整的大小
+ */
+
+const (
+	backupHistorySql = `
+		SELECT timestamp
+			 , coalesce(end_time,'')
+			 , coalesce(status,'')
+			 , coalesce(database_name,'')
+			 , coalesce(incremental::int,0)
+			 , coalesce(metadata_only::int,0)
+			 , coalesce(data_only::int,0)
+			 , coalesce(backup_dir,'')
+			 , coalesce(date_deleted,'')
+		  FROM %s
+		`
+
+	// gpbackup_history.db中以0/1保存布尔值
+	backupHistoryDBSql = `
+		SELECT timestamp
+			 , coalesce(end_time,'')
+			 , coalesce(status,'')
+			 , coalesce(database_name,'')
+			 , coalesce(incremental,0)
+			 , coalesce(metadata_only,0)
+			 , coalesce(data_only,0)
+			 , coalesce(backup_dir,'')
+			 , coalesce(date_deleted,'')
+		  FROM backups
+		`
+
+	// 未指定--backup-dir时备份文件位于master与各segment数据目录下的backups/<日期>/<时间戳>，
+	// 须由超级用户在每个segment上读取，某个segment上的目录不存在时查询报错
+	backupDataDirSizeSql = `
+		SELECT coalesce(sum(size),0)
+		  FROM (
+			SELECT (pg_stat_file('%[1]s/' || f)).size size
+			  FROM pg_ls_dir('%[1]s') f
+			UNION ALL
+			SELECT (pg_stat_file('%[1]s/' || pg_ls_dir('%[1]s'))).size
+			  FROM gp_dist_random('gp_id')
+		  ) s
+		`
+	primaryContentsSql = `SELECT content FROM gp_segment_configuration WHERE role='p' AND content>=0`
+
+	// gpbackup以本地时间记录的时间戳格式
+	backupTimestampLayout = "20060102150405"
+
+	backupStatusSuccess = "Success"
+)
+
+var (
+	backupTimestampPattern = regexp.MustCompile(`^[0-9]{14}$`)
+
+	// 每个segment目录的名称为gpseg<content>，master为gpseg-1
+	backupSegmentDirPattern = regexp.MustCompile(`^gpseg(-?[0-9]+)$`)
+
+	// --single-backup-dir时各segment的数据文件名以gpbackup_<content>_<时间戳>开头
+	backupDataFilePattern = regexp.MustCompile(`^gpbackup_(-?[0-9]+)_[0-9]{14}`)
+)
+
+var (
+	backupLastSuccessDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemBackup, "last_success_timestamp_seconds"),
+		"Finish time of the latest successful and not deleted gpbackup of each database",
+		[]string{"dbname"}, nil,
+	)
+
+	backupLastSizeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemBackup, "last_success_size_bytes"),
+		"Size of the latest successful gpbackup of each database, only reported when its backup directory is readable by the exporter",
+		[]string{"dbname"}, nil,
+	)
+
+	backupLastDurationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemBackup, "last_duration_seconds"),
+		"Duration of the latest finished gpbackup of each database",
+		[]string{"dbname"}, nil,
+	)
+
+	backupLastStatusDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemBackup, "last_status"),
+		"Whether the latest gpbackup of each database succeeded, 1 for Success and 0 for Failure or In Progress",
+		[]string{"dbname", "status", "backup_type"}, nil,
+	)
+)
+
+// gpbackup_history.yaml中的单次备份记录
+type backupConfig struct {
+	BackupDir    string `yaml:"backupdir"`
+	DatabaseName string `yaml:"databasename"`
+	DataOnly     bool   `yaml:"dataonly"`
+	DateDeleted  string `yaml:"datedeleted"`
+	Incremental  bool   `yaml:"incremental"`
+	MetadataOnly bool   `yaml:"metadataonly"`
+	Timestamp    string `yaml:"timestamp"`
+	EndTime      string `yaml:"endtime"`
+	Status       string `yaml:"status"`
+}
+
+type backupHistory struct {
+	BackupConfigs []backupConfig `yaml:"backupconfigs"`
+}
+
+func NewBackupScraper(historyFile, historyTable string) Scraper {
+	return backupScraper{historyFile: historyFile, historyTable: historyTable}
+}
+
+type backupScraper struct {
+	historyFile  string
+	historyTable string
+}
+
+func (backupScraper) Name() string {
+	return "backup_scraper"
+}
+
+// 未指定--backup-dir时通过pg_ls_dir与pg_stat_file统计备份大小，缺少权限时只是不输出备份大小
+func (s backupScraper) Requirements(ver int) Requirements {
+	req := Requirements{
+		Relations:         []string{"pg_catalog.gp_segment_configuration"},
+		OptionalFunctions: []string{"pg_catalog.pg_ls_dir", "pg_catalog.pg_stat_file"},
+	}
+	if s.historyTable != "" {
+		req.Relations = append(req.Relations, s.historyTable)
+	}
+
+	return req
+}
+
+func (s backupScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
+	var backups []backupConfig
+	var err error
+
+	switch {
+	case s.historyTable != "":
+		backups, err = queryBackupHistory(db, s.historyTable)
+	case strings.HasSuffix(s.historyFile, ".db"):
+		backups, err = readBackupHistoryDB(s.historyFile)
+	case s.historyFile != "":
+		backups, err = readBackupHistory(s.historyFile)
+	default:
+		err = errors.New("neither gpbackup history file nor history table is configured")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	latest := make(map[string]backupConfig)
+	latestSuccess := make(map[string]backupConfig)
+	for _, backup := range backups {
+		if backup.DatabaseName == "" {
+			continue
+		}
+
+		if last, ok := latest[backup.DatabaseName]; !ok || backup.Timestamp > last.Timestamp {
+			latest[backup.DatabaseName] = backup
+		}
+
+		if backup.Status != backupStatusSuccess || backup.DateDeleted != "" {
+			continue
+		}
+
+		if last, ok := latestSuccess[backup.DatabaseName]; !ok || backup.Timestamp > last.Timestamp {
+			latestSuccess[backup.DatabaseName] = backup
+		}
+	}
+
+	errs := make([]error, 0)
+
+	contents, err := queryPrimaryContents(db)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	for dbname, backup := range latest {
+		status := 0.0
+		if backup.Status == backupStatusSuccess {
+			status = 1
+		}
+
+		ch <- prometheus.MustNewConstMetric(backupLastStatusDesc, prometheus.GaugeValue, status, dbname, backup.Status, getBackupType(backup))
+
+		start, errS := parseBackupTime(backup.Timestamp)
+		end, errE := parseBackupTime(backup.EndTime)
+		if errS != nil || errE != nil {
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(backupLastDurationDesc, prometheus.GaugeValue, end.Sub(start).Seconds(), dbname)
+	}
+
+	for dbname, backup := range latestSuccess {
+		finish, err := parseBackupTime(backup.EndTime)
+		if err != nil {
+			if finish, err = parseBackupTime(backup.Timestamp); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+
+		ch <- prometheus.MustNewConstMetric(backupLastSuccessDesc, prometheus.GaugeValue, float64(finish.Unix()), dbname)
+
+		if size, ok := backupSize(db, backup, contents); ok {
+			ch <- prometheus.MustNewConstMetric(backupLastSizeDesc, prometheus.GaugeValue, size, dbname)
+		}
+	}
+
+	return combineErr(errs...)
+}
+
+func readBackupHistory(historyFile string) ([]backupConfig, error) {
+	logger.Infof("Read gpbackup history file: %s", historyFile)
+
+	content, err := ioutil.ReadFile(historyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var history backupHistory
+	if err = yaml.Unmarshal(content, &history); err != nil {
+		return nil, err
+	}
+
+	return history.BackupConfigs, nil
+}
+
+/**
+* 函数：readBackupHistoryDB
+* 功能：读取gpbackup 1.20起使用的SQLite格式备份历史文件gpbackup_history.db中的backups表
+ */
+func readBackupHistoryDB(historyFile string) ([]backupConfig, error) {
+	logger.Infof("Read gpbackup history database: %s", historyFile)
+
+	// 以只读方式打开，由SQLite处理日志与锁，WAL模式下已提交但未checkpoint的记录同样可见
+	dataSourceName := (&url.URL{Scheme: "file", Path: historyFile, RawQuery: "mode=ro"}).String()
+	conn, err := sql.Open("sqlite", dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	return scanBackupHistory(conn, backupHistoryDBSql)
+}
+
+func queryBackupHistory(db *sql.DB, historyTable string) ([]backupConfig, error) {
+	return scanBackupHistory(db, fmt.Sprintf(backupHistorySql, historyTable))
+}
+
+/**
+* 函数：scanBackupHistory
+* 功能：执行备份历史查询，按backupHistorySql的列顺序读取每次备份的记录
+ */
+func scanBackupHistory(db *sql.DB, querySql string) ([]backupConfig, error) {
+	rows, err := db.Query(querySql)
+	logger.Infof("Query Database: %s", querySql)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	backups := make([]backupConfig, 0)
+	for rows.Next() {
+		var backup backupConfig
+		var incremental, metadataOnly, dataOnly int
+
+		err = rows.Scan(&backup.Timestamp, &backup.EndTime, &backup.Status, &backup.DatabaseName,
+			&incremental, &metadataOnly, &dataOnly, &backup.BackupDir, &backup.DateDeleted)
+		if err != nil {
+			return nil, err
+		}
+
+		backup.Incremental = incremental != 0
+		backup.MetadataOnly = metadataOnly != 0
+		backup.DataOnly = dataOnly != 0
+
+		backups = append(backups, backup)
+	}
+
+	return backups, rows.Err()
+}
+
+func getBackupType(backup backupConfig) string {
+	switch {
+	case backup.MetadataOnly:
+		return "metadata_only"
+	case backup.DataOnly:
+		return "data_only"
+	case backup.Incremental:
+		return "incremental"
+	default:
+		return "full"
+	}
+}
+
+func parseBackupTime(timestamp string) (time.Time, error) {
+	return time.ParseInLocation(backupTimestampLayout, timestamp, time.Local)
+}
+
+func queryPrimaryContents(db *sql.DB) ([]int, error) {
+	rows, err := db.Query(primaryContentsSql)
+	logger.Infof("Query Database: %s", primaryContentsSql)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	contents := make([]int, 0)
+	for rows.Next() {
+		var content int
+		if err = rows.Scan(&content); err != nil {
+			return nil, err
+		}
+
+		contents = append(contents, content)
+	}
+
+	return contents, rows.Err()
+}
+
+/**
+* 函数：backupSize
+* 功能：统计master与所有primary segment上该次备份文件的大小，无法读取全部备份文件时返回false
+ */
+func backupSize(db *sql.DB, backup backupConfig, contents []int) (float64, bool) {
+	if !backupTimestampPattern.MatchString(backup.Timestamp) || contents == nil {
+		return 0, false
+	}
+
+	if backup.BackupDir == "" {
+		return backupSizeInDataDirs(db, backup)
+	}
+
+	return backupSizeInBackupDir(backup, contents)
+}
+
+func backupSizeInDataDirs(db *sql.DB, backup backupConfig) (float64, bool) {
+	querySql := fmt.Sprintf(backupDataDirSizeSql, filepath.Join("backups", backup.Timestamp[:8], backup.Timestamp))
+
+	var size float64
+	logger.Infof("Query Database: %s", querySql)
+	if err := db.QueryRow(querySql).Scan(&size); err != nil {
+		logger.Warnf("get size of gpbackup %s in segment data directories failed, error:%v", backup.Timestamp, err)
+		return 0, false
+	}
+
+	return size, true
+}
+
+/**
+* 函数：backupSizeInBackupDir
+* 功能：统计--backup-dir下该次备份的文件大小，备份目录须是exporter所在主机可读的共享存储
+*      使用--single-backup-dir时路径为<backupdir>/backups/<日期>/<时间戳>，否则为<backupdir>/gpseg<n>/backups/<日期>/<时间戳>
+ */
+func backupSizeInBackupDir(backup backupConfig, contents []int) (float64, bool) {
+	date := backup.Timestamp[:8]
+
+	var size int64
+	found := make(map[int]bool)
+
+	singleDir := filepath.Join(backup.BackupDir, "backups", date, backup.Timestamp)
+	if _, err := os.Stat(singleDir); err == nil {
+		err = filepath.Walk(singleDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if info.IsDir() {
+				return nil
+			}
+
+			size += info.Size()
+			if match := backupDataFilePattern.FindStringSubmatch(info.Name()); match != nil {
+				content, _ := strconv.Atoi(match[1])
+				found[content] = true
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			logger.Warnf("get size of backup directory %s failed, error:%v", singleDir, err)
+			return 0, false
+		}
+
+		// 元数据文件只由master写入
+		found[-1] = true
+	}
+
+	dirs, _ := filepath.Glob(filepath.Join(backup.BackupDir, "gpseg*", "backups", date, backup.Timestamp))
+	for _, dir := range dirs {
+		match := backupSegmentDirPattern.FindStringSubmatch(filepath.Base(filepath.Dir(filepath.Dir(filepath.Dir(dir)))))
+		if match == nil {
+			continue
+		}
+
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if !info.IsDir() {
+				size += info.Size()
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			logger.Warnf("get size of backup directory %s failed, error:%v", dir, err)
+			return 0, false
+		}
+
+		content, _ := strconv.Atoi(match[1])
+		found[content] = true
+	}
+
+	// 只备份元数据时segment上没有备份文件
+	missing := make([]int, 0)
+	if !found[-1] {
+		missing = append(missing, -1)
+	}
+
+	if !backup.MetadataOnly {
+		for _, content := range contents {
+			if !found[content] {
+				missing = append(missing, content)
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		logger.Warnf("backup files of gpbackup %s on segments %v are not readable from the exporter host, skip reporting its size", backup.Timestamp, missing)
+		return 0, false
+	}
+
+	return float64(size), true
+}
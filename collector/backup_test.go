@@ -0,0 +1,154 @@
+package collector
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// gpbackup创建的backups表，较新的版本追加了列
+const backupHistoryDBSchema = `
+	CREATE TABLE backups (
+		timestamp TEXT NOT NULL PRIMARY KEY, backup_dir TEXT, compressed INT, database_name TEXT,
+		data_only INT, date_deleted TEXT, incremental INT, metadata_only INT, status TEXT, end_time TEXT, with_statistics INT
+	)`
+
+func TestReadBackupHistoryDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	historyFile := filepath.Join(dir, "gpbackup_history.db")
+	writer, err := sql.Open("sqlite", historyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+
+	// 保持写连接打开且不做checkpoint，记录只存在于WAL文件中
+	statements := []string{
+		"PRAGMA journal_mode=WAL",
+		"PRAGMA wal_autocheckpoint=0",
+		backupHistoryDBSchema,
+		`INSERT INTO backups VALUES ('20240101000000','/data/backup',1,'db0',0,'',0,0,'Failure','20240101000059',NULL)`,
+		`INSERT INTO backups VALUES ('20240101010100','/data/backup',1,'db1',0,NULL,1,0,'Success','20240101010159',1)`,
+		`INSERT INTO backups (timestamp,database_name,metadata_only,status) VALUES ('20240102000000','db1',1,'Success')`,
+	}
+	writer.SetMaxOpenConns(1)
+	for _, statement := range statements {
+		if _, err = writer.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, err := readBackupHistoryDB(historyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []backupConfig{
+		{BackupDir: "/data/backup", DatabaseName: "db0", Timestamp: "20240101000000", EndTime: "20240101000059", Status: "Failure"},
+		{BackupDir: "/data/backup", DatabaseName: "db1", Incremental: true, Timestamp: "20240101010100", EndTime: "20240101010159", Status: backupStatusSuccess},
+		{DatabaseName: "db1", MetadataOnly: true, Timestamp: "20240102000000", Status: backupStatusSuccess},
+	}
+	if !reflect.DeepEqual(backups, want) {
+		t.Errorf("readBackupHistoryDB() = %+v, want %+v", backups, want)
+	}
+
+	if getBackupType(backups[1]) != "incremental" || getBackupType(backups[2]) != "metadata_only" || getBackupType(backups[0]) != "full" {
+		t.Errorf("unexpected backup types %s, %s, %s", getBackupType(backups[0]), getBackupType(backups[1]), getBackupType(backups[2]))
+	}
+
+	if _, err = readBackupHistoryDB(filepath.Join(dir, "missing.db")); err == nil {
+		t.Error("expected error for missing history database")
+	}
+}
+
+func TestBackupSizeInBackupDir(t *testing.T) {
+	const timestamp = "20240102030405"
+
+	tests := []struct {
+		name         string
+		files        map[string]int
+		metadataOnly bool
+		size         float64
+		ok           bool
+	}{
+		{
+			name: "segment directories",
+			files: map[string]int{
+				"gpseg-1/backups/20240102/20240102030405/gpbackup_20240102030405_metadata.sql": 100,
+				"gpseg0/backups/20240102/20240102030405/gpbackup_0_20240102030405_16384.gz":    10,
+				"gpseg1/backups/20240102/20240102030405/gpbackup_1_20240102030405_16384.gz":    20,
+				"gpseg1/backups/20240101/20240101000000/gpbackup_1_20240101000000_16384.gz":    1000,
+			},
+			size: 130,
+			ok:   true,
+		},
+		{
+			name: "segment directory not readable",
+			files: map[string]int{
+				"gpseg-1/backups/20240102/20240102030405/gpbackup_20240102030405_metadata.sql": 100,
+				"gpseg0/backups/20240102/20240102030405/gpbackup_0_20240102030405_16384.gz":    10,
+			},
+		},
+		{
+			name: "metadata only",
+			files: map[string]int{
+				"gpseg-1/backups/20240102/20240102030405/gpbackup_20240102030405_metadata.sql": 100,
+			},
+			metadataOnly: true,
+			size:         100,
+			ok:           true,
+		},
+		{
+			name: "single backup dir",
+			files: map[string]int{
+				"backups/20240102/20240102030405/gpbackup_20240102030405_metadata.sql": 100,
+				"backups/20240102/20240102030405/gpbackup_0_20240102030405_16384.gz":   10,
+				"backups/20240102/20240102030405/gpbackup_1_20240102030405_16384.gz":   20,
+			},
+			size: 130,
+			ok:   true,
+		},
+		{
+			name: "single backup dir missing segment files",
+			files: map[string]int{
+				"backups/20240102/20240102030405/gpbackup_20240102030405_metadata.sql": 100,
+				"backups/20240102/20240102030405/gpbackup_0_20240102030405_16384.gz":   10,
+			},
+		},
+		{
+			name: "no backup files",
+		},
+	}
+
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "backup")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		for name, size := range test.files {
+			path := filepath.Join(dir, name)
+			if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err = ioutil.WriteFile(path, make([]byte, size), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		backup := backupConfig{BackupDir: dir, Timestamp: timestamp, MetadataOnly: test.metadataOnly}
+		size, ok := backupSizeInBackupDir(backup, []int{0, 1})
+		if size != test.size || ok != test.ok {
+			t.Errorf("%s: backupSizeInBackupDir() = %v, %v, want %v, %v", test.name, size, ok, test.size, test.ok)
+		}
+	}
+}
@@ -11,11 +11,34 @@ import (
 // 参考地址：
 // （1） https://zhmin.github.io/2019/11/27/postgresql-bg-writer/
 // （2） https://zhmin.github.io/2019/11/24/postgresql-checkpoint/
+// master上的统计输出为greenplum_server_bgwriter_*，各个primary segment上的统计输出为greenplum_node_segment_bgwriter_*
+// Greenplum 5的pg_stat_bgwriter没有写入/同步耗时、fsync次数与重置时间，查询中以NULL代替，不输出对应指标
 const (
 	statBgwriterSql_V6 = ` SELECT checkpoints_timed, checkpoints_req, checkpoint_write_time, checkpoint_sync_time, buffers_checkpoint
 			 , buffers_clean, maxwritten_clean, buffers_backend, buffers_backend_fsync, buffers_alloc, stats_reset FROM pg_stat_bgwriter`
-	statBgwriterSql_V5 = ` SELECT checkpoints_timed, checkpoints_req, 0 as checkpoint_write_time, 0 as checkpoint_sync_time, buffers_checkpoint
-			 , buffers_clean, maxwritten_clean, buffers_backend, 0 as buffers_backend_fsync, buffers_alloc, '2020-06-16 22:09:47.078+08'::timestamp as stats_reset FROM pg_stat_bgwriter;`
+	statBgwriterSql_V5 = ` SELECT checkpoints_timed, checkpoints_req, null::float8 as checkpoint_write_time, null::float8 as checkpoint_sync_time, buffers_checkpoint
+			 , buffers_clean, maxwritten_clean, buffers_backend, null::bigint as buffers_backend_fsync, buffers_alloc, null::timestamptz as stats_reset FROM pg_stat_bgwriter;`
+
+	segmentBgwriterSql_V6 = `
+		SELECT c.content, c.hostname, b.checkpoints_timed, b.checkpoints_req, b.checkpoint_write_time, b.checkpoint_sync_time, b.buffers_checkpoint
+			 , b.buffers_clean, b.maxwritten_clean, b.buffers_backend, b.buffers_backend_fsync, b.buffers_alloc, b.stats_reset
+		  FROM gp_segment_configuration c
+		  JOIN (
+			SELECT gp_execution_segment() segid, *
+			  FROM gp_dist_random('pg_stat_bgwriter')
+		  ) b ON b.segid=c.content
+		WHERE c.role='p'
+		`
+	segmentBgwriterSql_V5 = `
+		SELECT c.content, c.hostname, b.checkpoints_timed, b.checkpoints_req, null::float8, null::float8, b.buffers_checkpoint
+			 , b.buffers_clean, b.maxwritten_clean, b.buffers_backend, null::bigint, b.buffers_alloc, null::timestamptz
+		  FROM gp_segment_configuration c
+		  JOIN (
+			SELECT gp_execution_segment() segid, *
+			  FROM gp_dist_random('pg_stat_bgwriter')
+		  ) b ON b.segid=c.content
+		WHERE c.role='p'
+		`
 )
 
 var (
@@ -97,6 +120,103 @@ var (
 	)
 )
 
+var (
+	segCheckpointsTimedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemNode, "segment_bgwriter_checkpoints_timed_total"),
+		"Number of scheduled checkpoints that have been performed on each primary segment",
+		[]string{"hostname", "content"}, nil,
+	)
+
+	segCheckpointsReqDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemNode, "segment_bgwriter_checkpoints_req_total"),
+		"Number of requested checkpoints that have been performed on each primary segment",
+		[]string{"hostname", "content"}, nil,
+	)
+
+	segCheckpointsReqRatioDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemNode, "segment_bgwriter_checkpoints_req_ratio"),
+		"Ratio of requested checkpoints to all checkpoints performed on each primary segment, a high value means checkpoints are triggered by WAL volume rather than checkpoint_timeout",
+		[]string{"hostname", "content"}, nil,
+	)
+
+	segCheckpointWriteTimeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemNode, "segment_bgwriter_checkpoint_write_time_seconds_total"),
+		"Total amount of time that has been spent in the portion of checkpoint processing where files are written to disk on each primary segment",
+		[]string{"hostname", "content"}, nil,
+	)
+
+	segCheckpointSyncTimeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemNode, "segment_bgwriter_checkpoint_sync_time_seconds_total"),
+		"Total amount of time that has been spent in the portion of checkpoint processing where files are synchronized to disk on each primary segment",
+		[]string{"hostname", "content"}, nil,
+	)
+
+	segBuffersCheckpointDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemNode, "segment_bgwriter_buffers_checkpoint_total"),
+		"Number of buffers written during checkpoints on each primary segment",
+		[]string{"hostname", "content"}, nil,
+	)
+
+	segBuffersCleanDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemNode, "segment_bgwriter_buffers_clean_total"),
+		"Number of buffers written by the background writer on each primary segment",
+		[]string{"hostname", "content"}, nil,
+	)
+
+	segMaxWrittenCleanDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemNode, "segment_bgwriter_maxwritten_clean_total"),
+		"Number of times the background writer stopped a cleaning scan because it had written too many buffers on each primary segment",
+		[]string{"hostname", "content"}, nil,
+	)
+
+	segBuffersBackendDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemNode, "segment_bgwriter_buffers_backend_total"),
+		"Number of buffers written directly by a backend on each primary segment",
+		[]string{"hostname", "content"}, nil,
+	)
+
+	segBuffersBackendFsyncDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemNode, "segment_bgwriter_buffers_backend_fsync_total"),
+		"Number of times a backend had to execute its own fsync call on each primary segment",
+		[]string{"hostname", "content"}, nil,
+	)
+
+	segBuffersAllocDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemNode, "segment_bgwriter_buffers_alloc_total"),
+		"Number of buffers allocated on each primary segment",
+		[]string{"hostname", "content"}, nil,
+	)
+
+	segStatsResetDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemNode, "segment_bgwriter_stats_reset_timestamp"),
+		"Time at which these statistics were last reset on each primary segment",
+		[]string{"hostname", "content"}, nil,
+	)
+)
+
+// pg_stat_bgwriter中的一行统计，Greenplum 5中不存在的列为NULL
+type bgwriterStat struct {
+	checkpointsTimed, checkpointsReq, buffersCheckpoint, buffersClean,
+	maxWrittenClean, buffersBackend, buffersAlloc int64
+	checkpointWriteTime, checkpointSyncTime sql.NullFloat64
+	buffersBackendFsync                     sql.NullInt64
+	statsReset                              *time.Time
+}
+
+func (s *bgwriterStat) scanDest() []interface{} {
+	return []interface{}{&s.checkpointsTimed,
+		&s.checkpointsReq,
+		&s.checkpointWriteTime,
+		&s.checkpointSyncTime,
+		&s.buffersCheckpoint,
+		&s.buffersClean,
+		&s.maxWrittenClean,
+		&s.buffersBackend,
+		&s.buffersBackendFsync,
+		&s.buffersAlloc,
+		&s.statsReset}
+}
+
 func NewBgWriterStateScraper() Scraper {
 	return &bgWriterStateScraper{}
 }
@@ -107,17 +227,30 @@ func (bgWriterStateScraper) Name() string {
 	return "bg_writer_state_scraper"
 }
 
+func (bgWriterStateScraper) Requirements(ver int) Requirements {
+	return Requirements{
+		Relations: []string{"pg_catalog.pg_stat_bgwriter", "pg_catalog.gp_segment_configuration"},
+		Functions: []string{"pg_catalog.gp_execution_segment"},
+	}
+}
+
 func (bgWriterStateScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
-	querySql :=statBgwriterSql_V6;
-	if ver < 6{
-		querySql=statBgwriterSql_V5;
+	errM := scrapeMasterBgwriter(db, ch, ver)
+	errS := scrapeSegmentBgwriter(db, ch, ver)
+
+	return combineErr(errM, errS)
+}
+
+func scrapeMasterBgwriter(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
+	querySql := statBgwriterSql_V6
+	if ver < verGP6 {
+		querySql = statBgwriterSql_V5
 	}
 
 	rows, err := db.Query(querySql)
 	logger.Infof("Query Database: %s", querySql)
 
 	if err != nil {
-		ch <- prometheus.MustNewConstMetric(stateDesc, prometheus.GaugeValue, 0, "", "")
 		logger.Errorf("get metrics for scraper, error:%v", err.Error())
 		return err
 	}
@@ -125,42 +258,93 @@ func (bgWriterStateScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver
 	defer rows.Close()
 
 	for rows.Next() {
-		var checkpointsTimedCounter, checkpointsReqCounter,
-		buffersCheckpoint, buffersClean, maxWrittenClean,
-		buffersBackend, buffersBackendFsync, buffersAlloc int64
-		var checkpointWriteTime, checkpointSyncTime float64
-		var statsReset time.Time
-
-		err = rows.Scan(&checkpointsTimedCounter,
-			&checkpointsReqCounter,
-			&checkpointWriteTime,
-			&checkpointSyncTime,
-			&buffersCheckpoint,
-			&buffersClean,
-			&maxWrittenClean,
-			&buffersBackend,
-			&buffersBackendFsync,
-			&buffersAlloc,
-			&statsReset)
+		var stat bgwriterStat
+
+		err = rows.Scan(stat.scanDest()...)
 		if err != nil {
 			logger.Errorf("get metrics for scraper, error:%v", err.Error())
 			return err
 		}
 
-		ch <- prometheus.MustNewConstMetric(checkpointsTimedDesc, prometheus.CounterValue, float64(checkpointsTimedCounter))
-		ch <- prometheus.MustNewConstMetric(checkpointsReqDesc, prometheus.CounterValue, float64(checkpointsReqCounter))
-		ch <- prometheus.MustNewConstMetric(checkpointWriteTimeDesc, prometheus.CounterValue, float64(checkpointWriteTime/1000))
-		ch <- prometheus.MustNewConstMetric(checkpointSyncTimeDesc, prometheus.CounterValue, float64(checkpointSyncTime/1000))
-		ch <- prometheus.MustNewConstMetric(buffersCheckpointDesc, prometheus.CounterValue, float64(buffersCheckpoint))
-		ch <- prometheus.MustNewConstMetric(buffersCleanDesc, prometheus.CounterValue, float64(buffersClean))
-		ch <- prometheus.MustNewConstMetric(maxWrittenCleanDesc, prometheus.CounterValue, float64(maxWrittenClean))
-		ch <- prometheus.MustNewConstMetric(buffersBackendDesc, prometheus.CounterValue, float64(buffersBackend))
-		ch <- prometheus.MustNewConstMetric(buffersBackendFsyncDesc, prometheus.CounterValue, float64(buffersBackendFsync))
-		ch <- prometheus.MustNewConstMetric(buffersAllocDesc, prometheus.CounterValue, float64(buffersAlloc))
-		ch <- prometheus.MustNewConstMetric(statsResetDesc, prometheus.GaugeValue, float64(statsReset.UTC().Unix()))
+		ch <- prometheus.MustNewConstMetric(checkpointsTimedDesc, prometheus.CounterValue, float64(stat.checkpointsTimed))
+		ch <- prometheus.MustNewConstMetric(checkpointsReqDesc, prometheus.CounterValue, float64(stat.checkpointsReq))
+		ch <- prometheus.MustNewConstMetric(buffersCheckpointDesc, prometheus.CounterValue, float64(stat.buffersCheckpoint))
+		ch <- prometheus.MustNewConstMetric(buffersCleanDesc, prometheus.CounterValue, float64(stat.buffersClean))
+		ch <- prometheus.MustNewConstMetric(maxWrittenCleanDesc, prometheus.CounterValue, float64(stat.maxWrittenClean))
+		ch <- prometheus.MustNewConstMetric(buffersBackendDesc, prometheus.CounterValue, float64(stat.buffersBackend))
+		ch <- prometheus.MustNewConstMetric(buffersAllocDesc, prometheus.CounterValue, float64(stat.buffersAlloc))
+
+		if stat.checkpointWriteTime.Valid {
+			ch <- prometheus.MustNewConstMetric(checkpointWriteTimeDesc, prometheus.CounterValue, stat.checkpointWriteTime.Float64/1000)
+		}
+		if stat.checkpointSyncTime.Valid {
+			ch <- prometheus.MustNewConstMetric(checkpointSyncTimeDesc, prometheus.CounterValue, stat.checkpointSyncTime.Float64/1000)
+		}
+		if stat.buffersBackendFsync.Valid {
+			ch <- prometheus.MustNewConstMetric(buffersBackendFsyncDesc, prometheus.CounterValue, float64(stat.buffersBackendFsync.Int64))
+		}
+		if stat.statsReset != nil {
+			ch <- prometheus.MustNewConstMetric(statsResetDesc, prometheus.GaugeValue, float64(stat.statsReset.UTC().Unix()))
+		}
 
 		return nil
 	}
 
 	return errors.New("bgwriter not found")
 }
+
+func scrapeSegmentBgwriter(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
+	querySql := segmentBgwriterSql_V6
+	if ver < verGP6 {
+		querySql = segmentBgwriterSql_V5
+	}
+
+	rows, err := db.Query(querySql)
+	logger.Infof("Query Database: %s", querySql)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	errs := make([]error, 0)
+
+	for rows.Next() {
+		var content, hostname string
+		var stat bgwriterStat
+
+		err = rows.Scan(append([]interface{}{&content, &hostname}, stat.scanDest()...)...)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(segCheckpointsTimedDesc, prometheus.CounterValue, float64(stat.checkpointsTimed), hostname, content)
+		ch <- prometheus.MustNewConstMetric(segCheckpointsReqDesc, prometheus.CounterValue, float64(stat.checkpointsReq), hostname, content)
+		ch <- prometheus.MustNewConstMetric(segBuffersCheckpointDesc, prometheus.CounterValue, float64(stat.buffersCheckpoint), hostname, content)
+		ch <- prometheus.MustNewConstMetric(segBuffersCleanDesc, prometheus.CounterValue, float64(stat.buffersClean), hostname, content)
+		ch <- prometheus.MustNewConstMetric(segMaxWrittenCleanDesc, prometheus.CounterValue, float64(stat.maxWrittenClean), hostname, content)
+		ch <- prometheus.MustNewConstMetric(segBuffersBackendDesc, prometheus.CounterValue, float64(stat.buffersBackend), hostname, content)
+		ch <- prometheus.MustNewConstMetric(segBuffersAllocDesc, prometheus.CounterValue, float64(stat.buffersAlloc), hostname, content)
+
+		if total := stat.checkpointsTimed + stat.checkpointsReq; total > 0 {
+			ch <- prometheus.MustNewConstMetric(segCheckpointsReqRatioDesc, prometheus.GaugeValue, float64(stat.checkpointsReq)/float64(total), hostname, content)
+		}
+
+		if stat.checkpointWriteTime.Valid {
+			ch <- prometheus.MustNewConstMetric(segCheckpointWriteTimeDesc, prometheus.CounterValue, stat.checkpointWriteTime.Float64/1000, hostname, content)
+		}
+		if stat.checkpointSyncTime.Valid {
+			ch <- prometheus.MustNewConstMetric(segCheckpointSyncTimeDesc, prometheus.CounterValue, stat.checkpointSyncTime.Float64/1000, hostname, content)
+		}
+		if stat.buffersBackendFsync.Valid {
+			ch <- prometheus.MustNewConstMetric(segBuffersBackendFsyncDesc, prometheus.CounterValue, float64(stat.buffersBackendFsync.Int64), hostname, content)
+		}
+		if stat.statsReset != nil {
+			ch <- prometheus.MustNewConstMetric(segStatsResetDesc, prometheus.GaugeValue, float64(stat.statsReset.UTC().Unix()), hostname, content)
+		}
+	}
+
+	return combineErr(errs...)
+}
@@ -0,0 +1,259 @@
+package collector
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	logger "github.com/prometheus/common/log"
+)
+
+/**
+ *  抓取器运行条件检查
+ *  抓取器通过Requirements按兼容级别声明所需的版本范围、系统表/视图、函数与扩展，
+ *  采集器在每次建立连接后检查一次，跳过无法运行的抓取器，而不是由抓取器在运行时判断或输出虚构的值；
+ *  使用非超级用户的监控角色时同时检查连接角色对这些对象的权限，缺少的权限通过指标与日志给出
+ */
+
+const (
+	relationAccessSql = `SELECT count(*), coalesce(bool_or(has_schema_privilege(n.oid,'USAGE') AND has_table_privilege(c.oid,'SELECT')),false)
+		  FROM pg_class c JOIN pg_namespace n ON c.relnamespace=n.oid WHERE c.relname=$2 AND (n.nspname=$1 OR $1='' AND pg_table_is_visible(c.oid))`
+	functionAccessSql = `SELECT count(*), coalesce(bool_or(has_schema_privilege(n.oid,'USAGE') AND has_function_privilege(p.oid,'EXECUTE')),false)
+		  FROM pg_proc p JOIN pg_namespace n ON p.pronamespace=n.oid WHERE p.proname=$2 AND (n.nspname=$1 OR $1='' AND pg_function_is_visible(p.oid))`
+	extensionExistsSql = `SELECT count(*) FROM pg_extension WHERE extname=$1`
+
+	// Greenplum 7起pg_read_all_stats角色的成员与超级用户一样可以看到其他角色会话的详细信息
+	allStatsSql    = `SELECT rolsuper FROM pg_roles WHERE rolname=current_user`
+	allStatsSql_V7 = `SELECT rolsuper OR pg_has_role(current_user,'pg_read_all_stats','MEMBER') FROM pg_roles WHERE rolname=current_user`
+)
+
+// 抓取器启用时的原因
+const reasonOK = "ok"
+
+var scraperEnabledDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, subsystemExporter, "scraper_enabled"),
+	"1 if the scraper can run against the connected database, otherwise 0 with the reason",
+	[]string{"scraper", "reason"}, nil,
+)
+
+var scraperMissingPrivilegeDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, subsystemExporter, "scraper_missing_privilege"),
+	"1 for each privilege the connected role lacks for the scraper, the scraper is disabled or reports partial data",
+	[]string{"scraper", "privilege"}, nil,
+)
+
+// 抓取器的运行条件，表、视图与函数须带模式名，安装位置不固定的扩展对象可以不带模式名，按search_path查找；
+// 连接角色须对表、视图有SELECT权限，对函数有EXECUTE权限
+type Requirements struct {
+	MinVersion int
+	MaxVersion int
+	Relations  []string
+	Functions  []string
+	Extensions []string
+
+	// 只影响部分指标的函数，缺少时抓取器仍运行，缺少的权限通过指标与日志给出
+	OptionalFunctions []string
+
+	// gpperfmon库中的表，在gpperfmon库的连接上检查；gpperfmon自Greenplum 7起移除
+	GpperfmonRelations []string
+
+	// 需要看到其他角色会话的详细信息（查询文本、状态等），不满足时抓取器仍运行但只能得到部分数据
+	AllStats bool
+}
+
+// 抓取器的检查结果，reason为reasonOK或不能运行的原因，missing为连接角色缺少的权限
+type capability struct {
+	reason  string
+	missing []string
+}
+
+// 声明了运行条件的抓取器，未实现该接口的抓取器总是运行；ver为连接的数据库的兼容级别，
+// 按版本使用不同SQL的抓取器据此声明该版本的SQL读取的对象
+type RequirementsScraper interface {
+	Scraper
+
+	Requirements(ver int) Requirements
+}
+
+/**
+* 函数：checkRequirements
+* 功能：检查运行条件，满足时返回ok，否则返回第一个不满足的条件；同时返回连接角色缺少的权限
+ */
+func checkRequirements(db *sql.DB, ver int, req Requirements) (string, []string, error) {
+	if req.MinVersion > 0 && ver < req.MinVersion {
+		return fmt.Sprintf("requires version %d or later", req.MinVersion), nil, nil
+	}
+
+	if req.MaxVersion > 0 && ver > req.MaxVersion {
+		return fmt.Sprintf("requires version %d or earlier", req.MaxVersion), nil, nil
+	}
+
+	for _, extension := range req.Extensions {
+		// pg_extension自Greenplum 6起提供
+		if ver < verGP6 {
+			return "missing extension " + extension, nil, nil
+		}
+
+		count, err := countRows(db, extensionExistsSql, extension)
+		if err != nil || count == 0 {
+			return "missing extension " + extension, nil, err
+		}
+	}
+
+	reason, missing, err := checkCatalogAccess(db, req.Relations, req.Functions)
+	if reason != reasonOK || err != nil {
+		return reason, privileges(missing), err
+	}
+
+	// gpperfmon在exporter运行期间安装时，重新建立连接后才会检查到
+	if len(req.GpperfmonRelations) > 0 {
+		perfmonDB, err := gpperfmon.connect(db)
+		if err != nil {
+			return "gpperfmon is not reachable", nil, err
+		}
+		if perfmonDB == nil {
+			return "gpperfmon is not installed", nil, nil
+		}
+
+		if reason, missing, err = checkCatalogAccess(perfmonDB, req.GpperfmonRelations, nil); reason != reasonOK || err != nil {
+			return reason, privileges(missing), err
+		}
+	}
+
+	var optional []string
+	for _, function := range req.OptionalFunctions {
+		exists, granted, err := catalogObjectAccess(db, functionAccessSql, function)
+		if err != nil {
+			logger.Errorf("check privilege EXECUTE on %s failed, error:%v", function, err)
+			continue
+		}
+		if exists && !granted {
+			logger.Warnf("missing privilege EXECUTE on %s, metrics depending on it are not reported", function)
+			optional = append(optional, "EXECUTE on "+function)
+		}
+	}
+
+	return reasonOK, optional, nil
+}
+
+func privileges(missing string) []string {
+	if missing == "" {
+		return nil
+	}
+
+	return []string{missing}
+}
+
+/**
+* 函数：checkCatalogAccess
+* 功能：检查表、视图与函数是否存在以及连接角色的权限，返回第一个不满足的条件与缺少的权限
+ */
+func checkCatalogAccess(db *sql.DB, relations, functions []string) (string, string, error) {
+	for _, relation := range relations {
+		exists, granted, err := catalogObjectAccess(db, relationAccessSql, relation)
+		if err != nil || !exists {
+			return "missing relation " + relation, "", err
+		}
+		if !granted {
+			return "missing privilege SELECT on " + relation, "SELECT on " + relation, nil
+		}
+	}
+
+	for _, function := range functions {
+		exists, granted, err := catalogObjectAccess(db, functionAccessSql, function)
+		if err != nil || !exists {
+			return "missing function " + function, "", err
+		}
+		if !granted {
+			return "missing privilege EXECUTE on " + function, "EXECUTE on " + function, nil
+		}
+	}
+
+	return reasonOK, "", nil
+}
+
+/**
+* 函数：catalogObjectAccess
+* 功能：检查表、视图或函数是否存在，以及连接角色能否访问，不带模式名时查找search_path中可见的对象
+ */
+func catalogObjectAccess(db *sql.DB, querySql string, name string) (exists bool, granted bool, err error) {
+	schema, object := "", name
+	if parts := strings.SplitN(name, ".", 2); len(parts) == 2 {
+		schema, object = parts[0], parts[1]
+	}
+
+	var count float64
+	logger.Infof("Query Database: %s", querySql)
+	err = db.QueryRow(querySql, schema, object).Scan(&count, &granted)
+
+	return count > 0, granted, err
+}
+
+/**
+* 函数：checkAllStats
+* 功能：检查连接角色能否看到其他角色会话的详细信息，不能时返回缺少的权限
+ */
+func checkAllStats(db *sql.DB, ver int) (string, error) {
+	querySql, missing := allStatsSql, "superuser"
+	if ver >= verGP7 {
+		querySql, missing = allStatsSql_V7, "pg_read_all_stats"
+	}
+
+	var granted bool
+	logger.Infof("Query Database: %s", querySql)
+	if err := db.QueryRow(querySql).Scan(&granted); err != nil || granted {
+		return "", err
+	}
+
+	return missing, nil
+}
+
+func countRows(db *sql.DB, querySql string, args ...interface{}) (count float64, err error) {
+	logger.Infof("Query Database: %s", querySql)
+	err = db.QueryRow(querySql, args...).Scan(&count)
+
+	return
+}
+
+/**
+* 函数：checkCapabilities
+* 功能：检查所有抓取器的运行条件与所需权限，返回抓取器名称到检查结果的映射
+ */
+func (c *GreenPlumCollector) checkCapabilities(db *sql.DB, ver int) map[string]capability {
+	capabilities := make(map[string]capability, len(c.scrapers))
+
+	allStats, allStatsErr := checkAllStats(db, ver)
+	if allStatsErr != nil {
+		logger.Errorf("check privilege to read all statistics failed, error:%v", allStatsErr)
+	}
+
+	for _, scraper := range c.scrapers {
+		result := capability{reason: reasonOK}
+		if s, ok := scraper.(RequirementsScraper); ok {
+			req := s.Requirements(ver)
+
+			reason, missing, err := checkRequirements(db, ver, req)
+			if err != nil {
+				logger.Errorf("check requirements of scraper:%s failed, error:%v", scraper.Name(), err)
+				reason = "requirements check failed"
+			}
+
+			result.reason = reason
+			result.missing = append(result.missing, missing...)
+
+			if req.AllStats && allStats != "" && result.reason == reasonOK {
+				result.missing = append(result.missing, allStats)
+				logger.Warnf("scraper:%s only sees sessions of the connected role, missing privilege %s", scraper.Name(), allStats)
+			}
+		}
+
+		if result.reason != reasonOK {
+			logger.Warnf("scraper:%s is disabled, %s", scraper.Name(), result.reason)
+		}
+
+		capabilities[scraper.Name()] = result
+	}
+
+	return capabilities
+}
@@ -14,14 +14,12 @@ import (
  */
 
 const (
-	checkStateSql        = `SELECT count(1) from gp_dist_random('gp_id')`
-	versionSql           = `select (select regexp_matches((select (select regexp_matches((select version()), 'Greenplum Database \d{1,}\.\d{1,}\.\d{1,}'))[1] as version), '\d{1,}\.\d{1,}\.\d{1,}'))[1];`
-	masterNameSql        = `SELECT hostname from gp_segment_configuration where content=-1 and role='p'`
-	standbyNameSql       = `SELECT hostname from gp_segment_configuration where content=-1 and role='m'`
-	upTimeSql            = `select extract(epoch from now() - pg_postmaster_start_time())`
-	syncSql              = `SELECT count(*) from pg_stat_replication where state='streaming'`
-	configLoadTimeSql_V6 = `SELECT pg_conf_load_time() `
-	configLoadTimeSql_V5 = `select '2020-06-16 22:09:47.078+08'::timestamp as pg_conf_load_time; `
+	checkStateSql     = `SELECT count(1) from gp_dist_random('gp_id')`
+	masterNameSql     = `SELECT hostname from gp_segment_configuration where content=-1 and role='p'`
+	standbyNameSql    = `SELECT hostname from gp_segment_configuration where content=-1 and role='m'`
+	upTimeSql         = `select extract(epoch from now() - pg_postmaster_start_time())`
+	syncSql           = `SELECT coalesce(sum(case when state='streaming' then 1 else 0 end),0), count(*)-count(state) from pg_stat_replication`
+	configLoadTimeSql = `SELECT pg_conf_load_time() `
 )
 
 var (
@@ -64,12 +62,17 @@ func (clusterStateScraper) Name() string {
 	return "cluster_state_scraper"
 }
 
+func (clusterStateScraper) Requirements(ver int) Requirements {
+	return Requirements{AllStats: true}
+}
+
 func (clusterStateScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
 	rows, err := db.Query(checkStateSql)
 	logger.Infof("Query Database: %s", checkStateSql)
 
 	if err != nil {
 		ch <- prometheus.MustNewConstMetric(stateDesc, prometheus.GaugeValue, 0, "", "", "")
+		clusterHealth.setClusterState(false, "", 0, false)
 		logger.Errorf("get metrics for scraper, error:%v", err.Error())
 		return err
 	}
@@ -81,6 +84,7 @@ func (clusterStateScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver i
 		err = rows.Scan(&count)
 		if err != nil {
 			ch <- prometheus.MustNewConstMetric(stateDesc, prometheus.GaugeValue, 0, "", "", "")
+			clusterHealth.setClusterState(false, "", 0, false)
 			logger.Errorf("get metrics for scraper, error:%v", err.Error())
 			return err
 		}
@@ -90,15 +94,49 @@ func (clusterStateScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver i
 	master, errM := scrapeMaster(db)
 	standby, errX := scrapeStandby(db)
 	upTime, errU := scrapeUpTime(db)
-	sync, errW := scrapeSync(db)
-	configLoadTime, errY := scrapeConfigLoadTime(db, ver)
+	sync, syncReadable, errW := scrapeSync(db)
 
 	ch <- prometheus.MustNewConstMetric(stateDesc, prometheus.GaugeValue, 1, version, master, standby)
 	ch <- prometheus.MustNewConstMetric(upTimeDesc, prometheus.GaugeValue, upTime)
-	ch <- prometheus.MustNewConstMetric(syncDesc, prometheus.GaugeValue, sync)
+
+	// 无权读取复制状态时不输出同步状态，避免误报standby未同步
+	if syncReadable {
+		ch <- prometheus.MustNewConstMetric(syncDesc, prometheus.GaugeValue, sync)
+	} else if errW == nil {
+		logger.Warnf("state of pg_stat_replication is not visible to the connected role, skip standby sync status")
+	}
+
+	if errX == nil && errW == nil {
+		clusterHealth.setClusterState(true, standby, sync, syncReadable)
+	}
+
+	return combineErr(errM, errV, errU, errW, errX)
+}
+
+func NewConfigLoadTimeScraper() Scraper {
+	return configLoadTimeScraper{}
+}
+
+type configLoadTimeScraper struct{}
+
+func (configLoadTimeScraper) Name() string {
+	return "config_load_time_scraper"
+}
+
+// pg_conf_load_time()自Greenplum 6起提供，更早的版本不运行该抓取器
+func (configLoadTimeScraper) Requirements(ver int) Requirements {
+	return Requirements{Functions: []string{"pg_catalog.pg_conf_load_time"}}
+}
+
+func (configLoadTimeScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
+	configLoadTime, err := scrapeConfigLoadTime(db)
+	if err != nil {
+		return err
+	}
+
 	ch <- prometheus.MustNewConstMetric(configLoadTimeDesc, prometheus.GaugeValue, float64(configLoadTime.UTC().Unix()))
 
-	return combineErr(errM, errV, errU, errW, errX, errY)
+	return nil
 }
 
 func scrapeUpTime(db *sql.DB) (upTime float64, err error) {
@@ -123,8 +161,8 @@ func scrapeUpTime(db *sql.DB) (upTime float64, err error) {
 }
 
 func scrapeVersion(db *sql.DB) (ver string, err error) {
-	rows, err := db.Query(versionSql)
-	logger.Infof("Query Database Version: %s", versionSql)
+	rows, err := db.Query(serverVersionSql)
+	logger.Infof("Query Database Version: %s", serverVersionSql)
 
 	if err != nil {
 		return
@@ -133,7 +171,14 @@ func scrapeVersion(db *sql.DB) (ver string, err error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		err = rows.Scan(&ver)
+		var version string
+		if err = rows.Scan(&version); err != nil {
+			return
+		}
+
+		var server serverVersion
+		server, err = parseServerVersion(version)
+		ver = server.version
 		return
 	}
 
@@ -179,7 +224,7 @@ func scrapeStandby(db *sql.DB) (host string, err error) {
 	return
 }
 
-func scrapeSync(db *sql.DB) (sync float64, err error) {
+func scrapeSync(db *sql.DB) (sync float64, readable bool, err error) {
 	rows, err := db.Query(syncSql)
 	logger.Infof("Query Database Sync : %s", syncSql)
 
@@ -190,7 +235,10 @@ func scrapeSync(db *sql.DB) (sync float64, err error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		err = rows.Scan(&sync)
+		// Greenplum 5/6中非超级用户看到的复制连接的state为NULL，此时无法判断是否同步
+		var hidden float64
+		err = rows.Scan(&sync, &hidden)
+		readable = err == nil && hidden == 0
 		return
 	}
 
@@ -198,14 +246,9 @@ func scrapeSync(db *sql.DB) (sync float64, err error) {
 	return
 }
 
-func scrapeConfigLoadTime(db *sql.DB, ver int) (time time.Time, err error) {
-	querySql := configLoadTimeSql_V6
-	if ver < 6 {
-		querySql = configLoadTimeSql_V5
-	}
-
-	rows, err := db.Query(querySql)
-	logger.Infof("Query Database Config load Time : %s", querySql)
+func scrapeConfigLoadTime(db *sql.DB) (time time.Time, err error) {
+	rows, err := db.Query(configLoadTimeSql)
+	logger.Infof("Query Database Config load Time : %s", configLoadTimeSql)
 
 	if err != nil {
 		return
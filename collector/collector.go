@@ -12,16 +12,26 @@ import (
 	"time"
 )
 
-const verMajorSql=`select (select regexp_matches((select (select regexp_matches((select version()), 'Greenplum Database \d{1,}\.\d{1,}\.\d{1,}'))[1] as version), '\d{1,}'))[1];`
-
 // 定义采集器数据类型结构体
 type GreenPlumCollector struct {
 	mu sync.Mutex
 
+	// connMu保护db与ver，抓取与后台采样共享同一个连接池
+	connMu   sync.Mutex
 	db       *sql.DB
 	ver       int
+	server   serverVersion
+
+	// 建立连接后检查的各抓取器能否运行及缺少的权限
+	capabilities map[string]capability
+
 	metrics  *ExporterMetrics
 	scrapers []Scraper
+
+	// statusMu保护供健康检查与首页展示使用的状态
+	statusMu      sync.RWMutex
+	lastConnected time.Time
+	statuses      map[string]ScraperStatus
 }
 
 /**
@@ -29,10 +39,19 @@ type GreenPlumCollector struct {
 * 功能：采集器的生成工厂方法
  */
 func NewCollector(enabledScrapers []Scraper) *GreenPlumCollector {
-	return &GreenPlumCollector{
+	c := &GreenPlumCollector{
 		metrics:  NewMetrics(),
 		scrapers: enabledScrapers,
+		statuses: make(map[string]ScraperStatus),
+	}
+
+	for _, scraper := range enabledScrapers {
+		if sampler, ok := scraper.(Sampler); ok {
+			go c.runSampler(sampler)
+		}
 	}
+
+	return c
 }
 
 /**
@@ -60,6 +79,9 @@ func (c *GreenPlumCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.metrics.scrapeDuration.Desc()
 	ch <- c.metrics.totalScraped.Desc()
 	ch <- c.metrics.totalError.Desc()
+	ch <- buildInfoDesc
+	ch <- scraperEnabledDesc
+	ch <- scraperMissingPrivilegeDesc
 }
 
 /**
@@ -73,7 +95,7 @@ func (c *GreenPlumCollector) scrape(ch chan<- prometheus.Metric) {
 	// 检查并与Greenplum建立连接
 	c.metrics.totalScraped.Inc()
 	watch.MustStart("check connections")
-	err := c.checkGreenPlumConn()
+	db, server, capabilities, err := c.connection()
 	watch.MustStop()
 	if err != nil {
 		c.metrics.totalError.Inc()
@@ -85,16 +107,35 @@ func (c *GreenPlumCollector) scrape(ch chan<- prometheus.Metric) {
 		return
 	}
 
-	defer c.db.Close()
-
 	logger.Info("check connections ok!")
 	c.metrics.greenPlumUp.Set(1)
+	ch <- prometheus.MustNewConstMetric(buildInfoDesc, prometheus.GaugeValue, 1, server.flavor, server.version, server.postgres)
+
+	ver := server.compat
 
-	// 遍历执行MAP中的所有抓取器
+	// 遍历执行MAP中的所有抓取器，跳过运行条件不满足的抓取器
 	for _, scraper := range c.scrapers {
+		checked := capabilities[scraper.Name()]
+		reason := checked.reason
+		enabled := 0.0
+		if reason == reasonOK {
+			enabled = 1
+		}
+		ch <- prometheus.MustNewConstMetric(scraperEnabledDesc, prometheus.GaugeValue, enabled, scraper.Name(), reason)
+		for _, privilege := range checked.missing {
+			ch <- prometheus.MustNewConstMetric(scraperMissingPrivilegeDesc, prometheus.GaugeValue, 1, scraper.Name(), privilege)
+		}
+
+		if reason != reasonOK {
+			c.setScraperDisabled(scraper.Name(), reason)
+			continue
+		}
+
 		logger.Info("#### scraping start : " + scraper.Name())
 		watch.MustStart("scraping: " + scraper.Name())
-		err := scraper.Scrape(c.db, ch, c.ver)
+		scrapeStart := time.Now()
+		err := scraper.Scrape(db, ch, ver)
+		c.setScraperStatus(scraper.Name(), scrapeStart, err)
 		watch.MustStop()
 		if err != nil {
 			logger.Errorf("get metrics for scraper:%s failed, error:%v", scraper.Name(), err.Error())
@@ -107,6 +148,56 @@ func (c *GreenPlumCollector) scrape(ch chan<- prometheus.Metric) {
 	logger.Info(fmt.Sprintf("prometheus scraped grennplum exporter successfully at %v, detail elapsed:%s", time.Now(), watch.PrettyPrint()))
 }
 
+/**
+* 函数：connection
+* 功能：检查并返回共享的数据库连接及数据库版本，连接不可用时重新建立
+ */
+func (c *GreenPlumCollector) connection() (*sql.DB, serverVersion, map[string]capability, error) {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+
+	if err := c.checkGreenPlumConn(); err != nil {
+		clusterHealth.setMasterConnection(err)
+		return nil, serverVersion{}, nil, err
+	}
+
+	clusterHealth.setMasterConnection(nil)
+	c.setConnected()
+
+	return c.db, c.server, c.capabilities, nil
+}
+
+/**
+* 函数：runSampler
+* 功能：按采样器的间隔在后台执行采样；为避免每次采样都检查连接，仅在尚未建立连接时建立连接，
+* 连接失效由下一次抓取检测并重建
+ */
+func (c *GreenPlumCollector) runSampler(sampler Sampler) {
+	ticker := time.NewTicker(sampler.Interval())
+	defer ticker.Stop()
+
+	for range ticker.C {
+		c.connMu.Lock()
+		if c.db == nil {
+			if err := c.getGreenPlumConnection(); err != nil {
+				c.connMu.Unlock()
+				logger.Errorf("sampler:%s connect database failed, error:%v", sampler.Name(), err)
+				continue
+			}
+		}
+		db, ver, checked := c.db, c.ver, c.capabilities[sampler.Name()]
+		c.connMu.Unlock()
+
+		if checked.reason != reasonOK {
+			continue
+		}
+
+		if err := sampler.Sample(db, ver); err != nil {
+			logger.Errorf("sample for sampler:%s failed, error:%v", sampler.Name(), err)
+		}
+	}
+}
+
 /**
 * 函数：checkGreenPlumConn
 * 功能：检查Greenplum数据库的连接
@@ -116,7 +207,7 @@ func (c *GreenPlumCollector) checkGreenPlumConn() (err error) {
 		return c.getGreenPlumConnection()
 	}
 
-	if err = c.getGreenplumMajorVersion(c.db); err == nil {
+	if err = c.getServerVersion(c.db); err == nil {
 		return nil
 	} else {
 		_ = c.db.Close()
@@ -140,47 +231,55 @@ func (c *GreenPlumCollector) getGreenPlumConnection() error {
 		return err
 	}
 
-	if err = c.getGreenplumMajorVersion(db); err != nil {
+	if err = c.getServerVersion(db); err != nil {
 		_ = db.Close()
 		return err
 	}
 
-	db.SetMaxIdleConns(1)
-	db.SetMaxOpenConns(1)
+	// 连接在多次抓取之间保持打开；启用后台采样器时，第二个连接避免采样排在耗时较长的抓取之后
+	db.SetMaxIdleConns(2)
+	db.SetMaxOpenConns(2)
 
 	c.db = db
+	c.capabilities = c.checkCapabilities(db, c.ver)
 
 	return nil
 }
 
 /**
-* 函数：getGreenplumMajorVersion
-* 功能：获取Greenplum数据库的主版本号
+* 函数：getServerVersion
+* 功能：识别数据库产品与版本，得到抓取器使用的兼容级别
  */
-func (c *GreenPlumCollector) getGreenplumMajorVersion(db *sql.DB) error {
+func (c *GreenPlumCollector) getServerVersion(db *sql.DB) error {
 	err := db.Ping()
 
 	if err != nil {
 		return err
 	}
 
-	rows, err := db.Query(verMajorSql)
+	rows, err := db.Query(serverVersionSql)
 
 	if err != nil {
 		return err
 	}
 
+	defer rows.Close()
+
 	for rows.Next() {
-		var verMajor int
-		errC := rows.Scan(&verMajor)
+		var version string
+		errC := rows.Scan(&version)
 		if errC != nil {
 			return errC
 		}
 
-		c.ver=verMajor
-	}
+		server, errP := parseServerVersion(version)
+		if errP != nil {
+			return errP
+		}
 
-	defer rows.Close()
+		c.server = server
+		c.ver = server.compat
+	}
 
-	return nil
+	return rows.Err()
 }
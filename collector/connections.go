@@ -20,6 +20,13 @@ const (
                          count(*) filter(where state='active' and not waiting) running,
                          count(*) filter(where state='active' and waiting) waiting
 						 from pg_stat_activity where pid <> pg_backend_pid();`
+	connectionsSql_V7 = `select 
+                         count(*) total, 
+                         count(*) filter(where state<>'active') idle, 
+                         count(*) filter(where state='active') active,
+                         count(*) filter(where state='active' and wait_event_type is distinct from 'Lock') running,
+                         count(*) filter(where state='active' and wait_event_type='Lock') waiting
+						 from pg_stat_activity where pid <> pg_backend_pid() and backend_type='client backend';`
 	connectionsSql_V5 = `select 
                          count(*) total, 
                          count(*) filter(where current_query='<IDLE>') idle, 
@@ -71,9 +78,15 @@ func (connectionsScraper) Name() string {
 	return "connections_scraper"
 }
 
+func (connectionsScraper) Requirements(ver int) Requirements {
+	return Requirements{AllStats: true}
+}
+
 func (connectionsScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
 	querySql := connectionsSql_V6
-	if ver < 6 {
+	if ver >= verGP7 {
+		querySql = connectionsSql_V7
+	} else if ver < verGP6 {
 		querySql = connectionsSql_V5
 	}
 
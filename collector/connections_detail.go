@@ -17,6 +17,11 @@ const (
                                       count(*) filter(where state<>'active') idle, 
                                       count(*) filter(where state='active') active 
 							   from pg_stat_activity group by 1;`
+	connectionsByUserSql_V7 = `select usename, 
+                                      count(*) total, 
+                                      count(*) filter(where state<>'active') idle, 
+                                      count(*) filter(where state='active') active 
+							   from pg_stat_activity where backend_type='client backend' group by 1;`
 	connectionsByUserSql_V5 = `select usename, 
                                       count(*) total, 
                                       count(*) filter(where current_query='<IDLE>') idle, 
@@ -27,6 +32,11 @@ const (
                                         count(*) filter(where state<>'active') idle,
                                         count(*) filter(where state='active') active
 								from pg_stat_activity where pid <> pg_backend_pid() group by 1;`
+	connectionsByClientAddressSql_V7 = `select client_addr,
+                                        count(*) total,
+                                        count(*) filter(where state<>'active') idle,
+                                        count(*) filter(where state='active') active
+								from pg_stat_activity where pid <> pg_backend_pid() and backend_type='client backend' group by 1;`
 	connectionsByClientAddressSql_V5 = `select client_addr,
                                                count(*) total,
                                                count(*) filter(where current_query='<IDLE>') idle,
@@ -94,6 +104,10 @@ func (connectionsDetailScraper) Name() string {
 	return "connections_detail_scraper"
 }
 
+func (connectionsDetailScraper) Requirements(ver int) Requirements {
+	return Requirements{AllStats: true}
+}
+
 func (connectionsDetailScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
 	errU := scrapeLoadByUser(db, ch, ver)
 	errC := scrapeLoadByClient(db, ch, ver)
@@ -103,7 +117,9 @@ func (connectionsDetailScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric,
 
 func scrapeLoadByUser(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
 	querySql := connectionsByUserSql_V6
-	if ver < 6 {
+	if ver >= verGP7 {
+		querySql = connectionsByUserSql_V7
+	} else if ver < verGP6 {
 		querySql = connectionsByUserSql_V5
 	}
 
@@ -145,7 +161,9 @@ func scrapeLoadByUser(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
 
 func scrapeLoadByClient(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
 	querySql := connectionsByClientAddressSql_V6
-	if ver < 6 {
+	if ver >= verGP7 {
+		querySql = connectionsByClientAddressSql_V7
+	} else if ver < verGP6 {
 		querySql = connectionsByClientAddressSql_V5
 	}
 
@@ -109,6 +109,10 @@ func (databaseSizeScraper) Name() string {
 	return "database_size_scraper"
 }
 
+func (databaseSizeScraper) Requirements(ver int) Requirements {
+	return Requirements{Relations: []string{"gp_toolkit.gp_size_of_database"}}
+}
+
 func (databaseSizeScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
 	ctx := context.Background()
 	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
@@ -0,0 +1,92 @@
+package collector
+
+import (
+	"database/sql"
+	"os"
+	"strings"
+
+	logger "github.com/prometheus/common/log"
+)
+
+/**
+ *  按数据库逐个抓取时使用的公共方法
+ */
+
+const (
+	databaseNamesSql = `SELECT datname from pg_database where datallowconn and datname not in ('template0','template1') order by 1;`
+)
+
+/**
+* 函数：queryDatabaseNames
+* 功能：获取集群中所有允许连接的数据库名称
+ */
+func queryDatabaseNames(db *sql.DB) ([]string, error) {
+	rows, err := db.Query(databaseNamesSql)
+	logger.Infof("Query Database: %s", databaseNamesSql)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	names := make([]string, 0)
+	for rows.Next() {
+		var dbname string
+		if err = rows.Scan(&dbname); err != nil {
+			return nil, err
+		}
+
+		names = append(names, dbname)
+	}
+
+	return names, rows.Err()
+}
+
+/**
+* 函数：openDatabase
+* 功能：以GPDB_DATA_SOURCE_URL为模板，建立到指定数据库的连接
+ */
+func openDatabase(dbname string) (*sql.DB, error) {
+	dataSourceName := os.Getenv("GPDB_DATA_SOURCE_URL")
+	newDataSourceName := strings.Replace(dataSourceName, "/postgres", "/"+dbname, 1)
+	logger.Infof("Connection string is : %s", newDataSourceName)
+
+	conn, err := sql.Open("postgres", newDataSourceName)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetMaxIdleConns(1)
+	conn.SetMaxOpenConns(1)
+
+	return conn, nil
+}
+
+/**
+* 函数：scrapeEachDatabase
+* 功能：对每个数据库建立连接并执行抓取函数，单个数据库的失败不影响其他数据库
+ */
+func scrapeEachDatabase(db *sql.DB, scrape func(dbname string, conn *sql.DB) error) error {
+	names, err := queryDatabaseNames(db)
+	if err != nil {
+		return err
+	}
+
+	errs := make([]error, 0)
+	for _, dbname := range names {
+		conn, err := openDatabase(dbname)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if err = scrape(dbname, conn); err != nil {
+			errs = append(errs, err)
+		}
+
+		_ = conn.Close()
+	}
+
+	return combineErr(errs...)
+}
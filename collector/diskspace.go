@@ -11,7 +11,6 @@ import (
  */
 
 const (
-	//?????????????????????????????????????
 	fileSystemSql = `select * from diskspace_now;`
 )
 
@@ -45,7 +44,28 @@ func (diskScraper) Name() string {
 	return "filesystem_scraper"
 }
 
+func (diskScraper) Requirements(ver int) Requirements {
+	return Requirements{MaxVersion: verGP6, GpperfmonRelations: []string{"public.diskspace_now"}}
+}
+
 func (diskScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
+	perfmonDB, err := gpperfmon.connect(db)
+	if err != nil {
+		return err
+	}
+
+	if perfmonDB == nil {
+		logger.Warn("gpperfmon is not installed, skip scraping diskspace_now")
+		return nil
+	}
+
+	errA := scrapeGpperfmonDataAge(perfmonDB, "diskspace_now", ch)
+	errS := scrapeDiskspaceNow(perfmonDB, ch)
+
+	return combineErr(errS, errA)
+}
+
+func scrapeDiskspaceNow(db *sql.DB, ch chan<- prometheus.Metric) error {
 	rows, err := db.Query(fileSystemSql)
 	logger.Infof("Query Database: %s",fileSystemSql)
 
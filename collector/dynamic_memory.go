@@ -11,8 +11,7 @@ import (
  */
 
 const (
-	//?????????????????????????????????????
-	dynamicMemorySql = `select hostname, dynamic_memory_used_mb, dynamic_memory_available_mb from  memory_info order by 1 DESC limit 1;`
+	dynamicMemorySql = `select hostname, dynamic_memory_used_mb, dynamic_memory_available_mb from memory_info where ctime = (select max(ctime) from memory_info);`
 )
 
 var (
@@ -39,7 +38,28 @@ func (dynamicMemoryScraper) Name() string {
 	return "dynamic_mem_scraper"
 }
 
+func (dynamicMemoryScraper) Requirements(ver int) Requirements {
+	return Requirements{MaxVersion: verGP6, GpperfmonRelations: []string{"public.memory_info"}}
+}
+
 func (dynamicMemoryScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
+	perfmonDB, err := gpperfmon.connect(db)
+	if err != nil {
+		return err
+	}
+
+	if perfmonDB == nil {
+		logger.Warn("gpperfmon is not installed, skip scraping memory_info")
+		return nil
+	}
+
+	errA := scrapeGpperfmonDataAge(perfmonDB, "memory_info", ch)
+	errS := scrapeMemoryInfo(perfmonDB, ch)
+
+	return combineErr(errS, errA)
+}
+
+func scrapeMemoryInfo(db *sql.DB, ch chan<- prometheus.Metric) error {
 	rows, err := db.Query(dynamicMemorySql)
 	logger.Infof("Query Database: %s",dynamicMemorySql)
 
@@ -8,6 +8,14 @@ const (
 	subsystemExporter = "exporter"
 	subSystemCluster  = "cluster"
 	subSystemNode     = "node"
+	subSystemBackup   = "backup"
+)
+
+// 识别到的数据库产品与版本，值恒为1
+var buildInfoDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, subSystemServer, "build_info"),
+	"Detected database flavor (greenplum or cloudberry), product version and PostgreSQL version, value is always 1",
+	[]string{"flavor", "version", "postgres_version"}, nil,
 )
 
 // 定义指标类型结构体
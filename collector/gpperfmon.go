@@ -0,0 +1,148 @@
+package collector
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	logger "github.com/prometheus/common/log"
+)
+
+/**
+ *  gpperfmon数据库连接管理
+ *  system_now、diskspace_now、database_now、memory_info等表位于gpperfmon库中，
+ *  连接串优先取环境变量GPPERFMON_DATA_SOURCE_URL，未设置时将GPDB_DATA_SOURCE_URL中的库名替换为gpperfmon
+ */
+
+const (
+	gpperfmonInstalledSql = `SELECT count(*) from pg_database where datname='gpperfmon'`
+	gpperfmonDataAgeSql   = `SELECT extract(epoch from now() - max(ctime)) from %s`
+)
+
+var (
+	gpperfmonDataAgeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemNode, "gpperfmon_data_age_seconds"),
+		"Seconds since the newest row of the gpperfmon table was collected, a large value means the gpmmon agent is not working",
+		[]string{"table"}, nil,
+	)
+)
+
+type gpperfmonConn struct {
+	mu sync.Mutex
+	db *sql.DB
+}
+
+var gpperfmon = &gpperfmonConn{}
+
+/**
+* 函数：connect
+* 功能：获取gpperfmon数据库的连接，gpperfmon未安装时返回nil
+ */
+func (p *gpperfmonConn) connect(master *sql.DB) (*sql.DB, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	installed, err := gpperfmonInstalled(master)
+	if err != nil {
+		return nil, err
+	}
+
+	if !installed {
+		p.close()
+		return nil, nil
+	}
+
+	if p.db != nil {
+		if err = p.db.Ping(); err == nil {
+			return p.db, nil
+		}
+
+		p.close()
+	}
+
+	db, err := sql.Open("postgres", gpperfmonDataSourceName())
+	if err != nil {
+		return nil, err
+	}
+
+	if err = db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	db.SetMaxIdleConns(1)
+	db.SetMaxOpenConns(1)
+
+	p.db = db
+
+	return p.db, nil
+}
+
+func (p *gpperfmonConn) close() {
+	if p.db != nil {
+		_ = p.db.Close()
+		p.db = nil
+	}
+}
+
+func gpperfmonDataSourceName() string {
+	if dataSourceName := os.Getenv("GPPERFMON_DATA_SOURCE_URL"); dataSourceName != "" {
+		return dataSourceName
+	}
+
+	dataSourceName := os.Getenv("GPDB_DATA_SOURCE_URL")
+	return strings.Replace(dataSourceName, "/postgres", "/gpperfmon", 1)
+}
+
+func gpperfmonInstalled(master *sql.DB) (bool, error) {
+	rows, err := master.Query(gpperfmonInstalledSql)
+	logger.Infof("Query Database: %s", gpperfmonInstalledSql)
+
+	if err != nil {
+		return false, err
+	}
+
+	defer rows.Close()
+
+	var count int
+	for rows.Next() {
+		if err = rows.Scan(&count); err != nil {
+			return false, err
+		}
+	}
+
+	return count > 0, rows.Err()
+}
+
+/**
+* 函数：scrapeGpperfmonDataAge
+* 功能：抓取gpperfmon表中最新数据距今的秒数，表为空时不输出
+ */
+func scrapeGpperfmonDataAge(db *sql.DB, table string, ch chan<- prometheus.Metric) error {
+	querySql := fmt.Sprintf(gpperfmonDataAgeSql, table)
+
+	rows, err := db.Query(querySql)
+	logger.Infof("Query Database: %s", querySql)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var age sql.NullFloat64
+		if err = rows.Scan(&age); err != nil {
+			return err
+		}
+
+		if age.Valid {
+			ch <- prometheus.MustNewConstMetric(gpperfmonDataAgeDesc, prometheus.GaugeValue, age.Float64, table)
+		}
+	}
+
+	return rows.Err()
+}
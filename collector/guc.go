@@ -0,0 +1,199 @@
+package collector
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	logger "github.com/prometheus/common/log"
+)
+
+/**
+ *  配置参数(GUC)一致性抓取器
+ *  对配置的每个参数，读取master及每个primary segment上的取值，输出可转换为数值的取值，
+ *  并在任一segment与master取值不一致时将漂移指标置为1；master与segment有意配置不同的参数（如max_connections）不应列入
+ *  带单位的取值与pg_settings.unit声明了单位的参数换算为字节或秒，未声明单位的参数（如以MB为单位的gp_vmem_protect_limit）按原值输出
+ */
+
+const (
+	gucSettingSql = `
+		SELECT c.content, c.hostname, p.value, coalesce((SELECT unit FROM pg_settings WHERE name=$1),'')
+		  FROM gp_segment_configuration c
+		  JOIN (
+			SELECT -1 segid, current_setting($1) value
+			UNION ALL
+			SELECT paramsegment, paramvalue
+			  FROM gp_toolkit.gp_param_setting($1)
+			WHERE paramsegment >= 0
+		  ) p ON p.segid=c.content
+		WHERE c.role='p'
+		`
+)
+
+var (
+	gucValueDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemNode, "segment_guc_value"),
+		"Numeric value of the configuration parameter on master and each primary segment, memory in bytes and time in seconds when the value or pg_settings has a unit, otherwise the raw value",
+		[]string{"hostname", "content", "name"}, nil,
+	)
+
+	gucDriftDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemCluster, "guc_drift"),
+		"1 if any primary segment has a different value of the configuration parameter than master, otherwise 0",
+		[]string{"name"}, nil,
+	)
+
+	gucDriftSegmentsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemCluster, "guc_drift_segments"),
+		"Number of primary segments having a different value of the configuration parameter than master",
+		[]string{"name"}, nil,
+	)
+)
+
+// 内存单位换算为字节，时间单位换算为秒
+var settingUnits = map[string]float64{
+	"kB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30, "TB": 1 << 40,
+	"ms": 0.001, "s": 1, "min": 60, "h": 3600, "d": 86400,
+}
+
+func NewGucScraper(names []string) Scraper {
+	return &gucScraper{names: names}
+}
+
+type gucScraper struct {
+	names []string
+}
+
+func (gucScraper) Name() string {
+	return "guc_scraper"
+}
+
+func (gucScraper) Requirements(ver int) Requirements {
+	return Requirements{Functions: []string{"gp_toolkit.gp_param_setting"}}
+}
+
+func (s gucScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
+	errs := make([]error, 0)
+
+	for _, name := range s.names {
+		if err := scrapeGucSetting(db, name, ch); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return combineErr(errs...)
+}
+
+func scrapeGucSetting(db *sql.DB, name string, ch chan<- prometheus.Metric) error {
+	rows, err := db.Query(gucSettingSql, name)
+	logger.Infof("Query Database: %s", gucSettingSql)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	var masterValue string
+	segmentValues := make([]string, 0)
+	for rows.Next() {
+		var content, hostname, value, unit string
+
+		if err = rows.Scan(&content, &hostname, &value, &unit); err != nil {
+			return err
+		}
+
+		if content == "-1" {
+			masterValue = value
+		} else {
+			segmentValues = append(segmentValues, value)
+		}
+
+		if v, ok := parseSetting(value, unit); ok {
+			ch <- prometheus.MustNewConstMetric(gucValueDesc, prometheus.GaugeValue, v, hostname, content, name)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	var driftSegments float64
+	for _, value := range segmentValues {
+		if value != masterValue {
+			driftSegments++
+		}
+	}
+
+	drift := 0.0
+	if driftSegments > 0 {
+		drift = 1
+	}
+
+	ch <- prometheus.MustNewConstMetric(gucDriftDesc, prometheus.GaugeValue, drift, name)
+	ch <- prometheus.MustNewConstMetric(gucDriftSegmentsDesc, prometheus.GaugeValue, driftSegments, name)
+
+	return nil
+}
+
+/**
+* 函数：parseSetting
+* 功能：将参数取值转换为数值，支持on/off以及带内存、时间单位的取值，无法转换时返回false
+*      取值不带单位时按pg_settings.unit（如8kB、ms）换算，负数通常表示禁用等特殊含义，不做换算
+ */
+func parseSetting(value string, defaultUnit string) (float64, bool) {
+	value = strings.TrimSpace(value)
+
+	switch strings.ToLower(value) {
+	case "on", "true":
+		return 1, true
+	case "off", "false":
+		return 0, true
+	}
+
+	number := strings.TrimRightFunc(value, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+
+	v, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	unit := strings.TrimSpace(value[len(number):])
+	if unit != "" {
+		multiplier, ok := settingUnits[unit]
+		return v * multiplier, ok
+	}
+
+	if strings.HasPrefix(number, "-") || defaultUnit == "" {
+		return v, true
+	}
+
+	multiplier, ok := parseSettingUnit(defaultUnit)
+	if !ok {
+		return 0, false
+	}
+
+	return v * multiplier, true
+}
+
+// 解析pg_settings.unit，如8kB表示8个kB
+func parseSettingUnit(unit string) (float64, bool) {
+	name := strings.TrimLeft(unit, "0123456789")
+	multiplier, ok := settingUnits[name]
+	if !ok {
+		return 0, false
+	}
+
+	if count := unit[:len(unit)-len(name)]; count != "" {
+		n, err := strconv.ParseFloat(count, 64)
+		if err != nil {
+			return 0, false
+		}
+		multiplier *= n
+	}
+
+	return multiplier, true
+}
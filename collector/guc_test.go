@@ -0,0 +1,38 @@
+package collector
+
+import "testing"
+
+func TestParseSetting(t *testing.T) {
+	tests := []struct {
+		value string
+		unit  string
+		want  float64
+		ok    bool
+	}{
+		{value: "on", want: 1, ok: true},
+		{value: "OFF", want: 0, ok: true},
+		{value: "true", want: 1, ok: true},
+		{value: "8192", want: 8192, ok: true},
+		{value: "125MB", unit: "8kB", want: 125 << 20, ok: true},
+		{value: "4GB", unit: "kB", want: 4 << 30, ok: true},
+		{value: " 512kB ", want: 512 << 10, ok: true},
+		{value: "1500ms", unit: "ms", want: 1.5, ok: true},
+		{value: "5min", unit: "s", want: 300, ok: true},
+		{value: "16384", unit: "8kB", want: 16384 * 8 << 10, ok: true},
+		{value: "30000", unit: "ms", want: 30, ok: true},
+		{value: "0", unit: "ms", want: 0, ok: true},
+		{value: "-1", unit: "ms", want: -1, ok: true},
+		{value: "0.5", want: 0.5, ok: true},
+		{value: "10", unit: "furlong"},
+		{value: "10PB"},
+		{value: "minimal"},
+		{value: ""},
+	}
+
+	for _, test := range tests {
+		got, ok := parseSetting(test.value, test.unit)
+		if got != test.want || ok != test.ok {
+			t.Errorf("parseSetting(%q, %q) = %v, %v, want %v, %v", test.value, test.unit, got, ok, test.want, test.ok)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ *  集群健康汇总
+ *  segmentScraper与clusterStateScraper在每次抓取时记录segment配置与master/standby状态，
+ *  按规则将最近一次抓取的结果汇总为ok、degraded或critical，规则的级别可配置；
+ *  最近一次连接master失败时立即触发unreachable规则，不再使用之前抓取的结果
+ */
+
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+	HealthCritical = "critical"
+)
+
+// 健康规则及其默认级别
+const (
+	RuleUnreachable         = "unreachable"
+	RuleStale               = "stale"
+	RulePrimaryDown         = "primary_down"
+	RuleMirrorDown          = "mirror_down"
+	RuleNotPreferredRole    = "not_preferred_role"
+	RuleNotSynced           = "not_synced"
+	RuleStandbyNotStreaming = "standby_not_streaming"
+)
+
+var defaultHealthRules = map[string]string{
+	RuleUnreachable:         HealthCritical,
+	RuleStale:               HealthDegraded,
+	RulePrimaryDown:         HealthCritical,
+	RuleMirrorDown:          HealthDegraded,
+	RuleNotPreferredRole:    HealthDegraded,
+	RuleNotSynced:           HealthDegraded,
+	RuleStandbyNotStreaming: HealthDegraded,
+}
+
+var healthSeverity = map[string]int{HealthOK: 0, HealthDegraded: 1, HealthCritical: 2}
+
+type HealthIssue struct {
+	Rule    string `json:"rule"`
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+type HealthReport struct {
+	Status    string        `json:"status"`
+	ScrapedAt *time.Time    `json:"scraped_at,omitempty"`
+	Issues    []HealthIssue `json:"issues"`
+}
+
+type segmentHealth struct {
+	dbID, content, hostname           string
+	role, preferredRole, mode, status string
+}
+
+// 最近一次抓取记录的集群状态，由segmentScraper与clusterStateScraper写入
+type healthSnapshot struct {
+	mu sync.RWMutex
+
+	segmentsAt time.Time
+	segments   []segmentHealth
+
+	clusterAt time.Time
+	reachable bool
+	standby   string
+	streaming float64
+
+	// 连接角色能否看到pg_stat_replication的复制状态，看不到时不检查standby
+	streamingReadable bool
+
+	// 最近一次连接master的错误，连接成功时为nil
+	masterErr error
+}
+
+var clusterHealth healthSnapshot
+
+func (h *healthSnapshot) setSegments(segments []segmentHealth) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.segmentsAt = time.Now()
+	h.segments = segments
+}
+
+func (h *healthSnapshot) setClusterState(reachable bool, standby string, streaming float64, streamingReadable bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.clusterAt = time.Now()
+	h.reachable = reachable
+	h.standby = standby
+	h.streaming = streaming
+	h.streamingReadable = streamingReadable
+}
+
+func (h *healthSnapshot) setMasterConnection(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.masterErr = err
+}
+
+/**
+* 函数：ParseHealthRules
+* 功能：解析逗号分隔的rule=level列表，未列出的规则使用默认级别，级别为ok时忽略该规则
+ */
+func ParseHealthRules(s string) (map[string]string, error) {
+	rules := make(map[string]string, len(defaultHealthRules))
+	for rule, level := range defaultHealthRules {
+		rules[rule] = level
+	}
+
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid health rule %q, expect rule=level", item)
+		}
+
+		rule, level := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if _, ok := defaultHealthRules[rule]; !ok {
+			return nil, fmt.Errorf("unknown health rule %q", rule)
+		}
+
+		if _, ok := healthSeverity[level]; !ok {
+			return nil, fmt.Errorf("invalid level %q of health rule %q, expect ok, degraded or critical", level, rule)
+		}
+
+		rules[rule] = level
+	}
+
+	return rules, nil
+}
+
+/**
+* 函数：EvaluateHealth
+* 功能：按规则汇总最近一次抓取的集群状态，超过maxAge未抓取时触发stale规则
+ */
+func EvaluateHealth(rules map[string]string, maxAge time.Duration) HealthReport {
+	return clusterHealth.evaluate(rules, maxAge)
+}
+
+func (h *healthSnapshot) evaluate(rules map[string]string, maxAge time.Duration) HealthReport {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	report := HealthReport{Status: HealthOK, Issues: make([]HealthIssue, 0)}
+	add := func(rule, format string, args ...interface{}) {
+		level := rules[rule]
+		if level == HealthOK {
+			return
+		}
+
+		report.Issues = append(report.Issues, HealthIssue{Rule: rule, Level: level, Message: fmt.Sprintf(format, args...)})
+		if healthSeverity[level] > healthSeverity[report.Status] {
+			report.Status = level
+		}
+	}
+
+	if h.masterErr != nil {
+		add(RuleUnreachable, "master is not reachable: %v", h.masterErr)
+		return report
+	}
+
+	if h.clusterAt.IsZero() || h.segmentsAt.IsZero() {
+		add(RuleStale, "cluster state or segment configuration has not been scraped yet")
+		return report
+	}
+
+	scrapedAt := h.clusterAt
+	if h.segmentsAt.Before(scrapedAt) {
+		scrapedAt = h.segmentsAt
+	}
+	report.ScrapedAt = &scrapedAt
+
+	if time.Since(scrapedAt) > maxAge {
+		add(RuleStale, "last scrape at %s is older than %s", scrapedAt.Format(time.RFC3339), maxAge)
+	}
+
+	if !h.reachable {
+		add(RuleUnreachable, "segments are not reachable from master")
+	}
+
+	if h.standby != "" && h.streamingReadable && h.streaming == 0 {
+		add(RuleStandbyNotStreaming, "standby master %s is not streaming", h.standby)
+	}
+
+	// 未配置mirror的集群中primary的mode为n，只检查有mirror的content是否同步
+	mirrored := make(map[string]bool)
+	for _, seg := range h.segments {
+		if seg.role == "m" {
+			mirrored[seg.content] = true
+		}
+	}
+
+	for _, seg := range h.segments {
+		if seg.content == "-1" {
+			continue
+		}
+
+		if seg.status == "d" {
+			if seg.role == "p" {
+				add(RulePrimaryDown, "primary dbid=%s content=%s on %s is down", seg.dbID, seg.content, seg.hostname)
+			} else {
+				add(RuleMirrorDown, "mirror dbid=%s content=%s on %s is down", seg.dbID, seg.content, seg.hostname)
+			}
+		}
+
+		if seg.role != seg.preferredRole {
+			add(RuleNotPreferredRole, "segment dbid=%s content=%s on %s is not in its preferred role", seg.dbID, seg.content, seg.hostname)
+		}
+
+		if seg.role == "p" && seg.status == "u" && mirrored[seg.content] && seg.mode != "s" {
+			add(RuleNotSynced, "primary dbid=%s content=%s on %s is not synchronized with its mirror", seg.dbID, seg.content, seg.hostname)
+		}
+	}
+
+	sort.SliceStable(report.Issues, func(i, j int) bool {
+		return healthSeverity[report.Issues[i].Level] > healthSeverity[report.Issues[j].Level]
+	})
+
+	return report
+}
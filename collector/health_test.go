@@ -0,0 +1,170 @@
+package collector
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseHealthRules(t *testing.T) {
+	tests := []struct {
+		s       string
+		changed map[string]string
+		err     bool
+	}{
+		{s: ""},
+		{s: " not_preferred_role=ok , mirror_down=critical,", changed: map[string]string{RuleNotPreferredRole: HealthOK, RuleMirrorDown: HealthCritical}},
+		{s: "stale", err: true},
+		{s: "unknown=ok", err: true},
+		{s: "stale=warning", err: true},
+	}
+
+	for _, test := range tests {
+		rules, err := ParseHealthRules(test.s)
+		if test.err {
+			if err == nil {
+				t.Errorf("ParseHealthRules(%q) expected error", test.s)
+			}
+			continue
+		}
+
+		want := make(map[string]string)
+		for rule, level := range defaultHealthRules {
+			want[rule] = level
+		}
+		for rule, level := range test.changed {
+			want[rule] = level
+		}
+
+		if err != nil || !reflect.DeepEqual(rules, want) {
+			t.Errorf("ParseHealthRules(%q) = %v, %v, want %v", test.s, rules, err, want)
+		}
+	}
+}
+
+func TestEvaluateHealth(t *testing.T) {
+	now := time.Now()
+	primary := func(content, mode, status string) segmentHealth {
+		return segmentHealth{dbID: content, content: content, hostname: "sdw", role: "p", preferredRole: "p", mode: mode, status: status}
+	}
+	mirror := func(content, status string) segmentHealth {
+		return segmentHealth{dbID: "m" + content, content: content, hostname: "sdw", role: "m", preferredRole: "m", mode: "s", status: status}
+	}
+	master := segmentHealth{dbID: "1", content: "-1", hostname: "mdw", role: "p", preferredRole: "p", mode: "n", status: "u"}
+
+	tests := []struct {
+		name     string
+		snapshot *healthSnapshot
+		rules    map[string]string
+		status   string
+		issues   []string
+	}{
+		{
+			name:     "healthy with mirrors",
+			snapshot: &healthSnapshot{clusterAt: now, segmentsAt: now, reachable: true, segments: []segmentHealth{master, primary("0", "s", "u"), mirror("0", "u")}},
+			status:   HealthOK,
+		},
+		{
+			name:     "healthy without mirrors",
+			snapshot: &healthSnapshot{clusterAt: now, segmentsAt: now, reachable: true, segments: []segmentHealth{master, primary("0", "n", "u"), primary("1", "n", "u")}},
+			status:   HealthOK,
+		},
+		{
+			name:     "mirror down and not synced",
+			snapshot: &healthSnapshot{clusterAt: now, segmentsAt: now, reachable: true, segments: []segmentHealth{master, primary("0", "n", "u"), mirror("0", "d")}},
+			status:   HealthDegraded,
+			issues:   []string{RuleNotSynced, RuleMirrorDown},
+		},
+		{
+			name:     "primary down",
+			snapshot: &healthSnapshot{clusterAt: now, segmentsAt: now, reachable: true, segments: []segmentHealth{master, primary("0", "n", "d"), mirror("0", "u")}},
+			status:   HealthCritical,
+			issues:   []string{RulePrimaryDown},
+		},
+		{
+			name: "failover",
+			snapshot: &healthSnapshot{clusterAt: now, segmentsAt: now, reachable: true, segments: []segmentHealth{master,
+				{dbID: "2", content: "0", role: "m", preferredRole: "p", mode: "n", status: "d"},
+				{dbID: "3", content: "0", role: "p", preferredRole: "m", mode: "n", status: "u"}}},
+			status: HealthDegraded,
+			issues: []string{RuleMirrorDown, RuleNotPreferredRole, RuleNotPreferredRole, RuleNotSynced},
+		},
+		{
+			name:     "rule disabled",
+			snapshot: &healthSnapshot{clusterAt: now, segmentsAt: now, reachable: true, segments: []segmentHealth{master, primary("0", "n", "u"), mirror("0", "d")}},
+			rules:    map[string]string{RuleMirrorDown: HealthOK, RuleNotSynced: HealthOK},
+			status:   HealthOK,
+		},
+		{
+			name:     "standby not streaming",
+			snapshot: &healthSnapshot{clusterAt: now, segmentsAt: now, reachable: true, standby: "smdw", streamingReadable: true, segments: []segmentHealth{master}},
+			status:   HealthDegraded,
+			issues:   []string{RuleStandbyNotStreaming},
+		},
+		{
+			name:     "standby streaming",
+			snapshot: &healthSnapshot{clusterAt: now, segmentsAt: now, reachable: true, standby: "smdw", streaming: 1, streamingReadable: true, segments: []segmentHealth{master}},
+			status:   HealthOK,
+		},
+		{
+			name:     "replication state not visible",
+			snapshot: &healthSnapshot{clusterAt: now, segmentsAt: now, reachable: true, standby: "smdw", segments: []segmentHealth{master}},
+			status:   HealthOK,
+		},
+		{
+			name:     "segments unreachable",
+			snapshot: &healthSnapshot{clusterAt: now, segmentsAt: now, segments: []segmentHealth{master}},
+			status:   HealthCritical,
+			issues:   []string{RuleUnreachable},
+		},
+		{
+			name:     "never scraped",
+			snapshot: &healthSnapshot{},
+			status:   HealthDegraded,
+			issues:   []string{RuleStale},
+		},
+		{
+			name:     "stale",
+			snapshot: &healthSnapshot{clusterAt: now.Add(-time.Hour), segmentsAt: now, reachable: true, segments: []segmentHealth{master}},
+			status:   HealthDegraded,
+			issues:   []string{RuleStale},
+		},
+		{
+			name:     "master unreachable with a recent snapshot",
+			snapshot: &healthSnapshot{clusterAt: now, segmentsAt: now, reachable: true, segments: []segmentHealth{master}, masterErr: errors.New("connection refused")},
+			status:   HealthCritical,
+			issues:   []string{RuleUnreachable},
+		},
+		{
+			name:     "master unreachable before the first scrape",
+			snapshot: &healthSnapshot{masterErr: errors.New("connection refused")},
+			status:   HealthCritical,
+			issues:   []string{RuleUnreachable},
+		},
+	}
+
+	for _, test := range tests {
+		rules, err := ParseHealthRules("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rule, level := range test.rules {
+			rules[rule] = level
+		}
+
+		report := test.snapshot.evaluate(rules, 5*time.Minute)
+
+		issues := make([]string, 0)
+		for _, issue := range report.Issues {
+			issues = append(issues, issue.Rule)
+		}
+		if test.issues == nil {
+			test.issues = []string{}
+		}
+
+		if report.Status != test.status || !reflect.DeepEqual(issues, test.issues) {
+			t.Errorf("%s: evaluate() = %s %v, want %s %v", test.name, report.Status, issues, test.status, test.issues)
+		}
+	}
+}
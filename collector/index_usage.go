@@ -0,0 +1,174 @@
+package collector
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	logger "github.com/prometheus/common/log"
+)
+
+/**
+ *  索引使用情况抓取器
+ *  按数据库统计索引数量、从未被扫描过的索引占用空间、无效索引数量，以及最大的若干个未使用索引
+ *  唯一索引用于保证约束，即使从未被扫描也不计入未使用索引
+ *  分布表的索引扫描发生在segment上，master上的idx_scan始终为0，因此按indexrelid汇总各segment上的扫描次数
+ */
+
+const (
+	// 各segment上的索引扫描次数，Greenplum 7起gp_stat_user_indexes汇总了coordinator与所有segment
+	segmentIndexScansSql    = `SELECT indexrelid, sum(idx_scan) idx_scan FROM gp_dist_random('pg_stat_user_indexes') GROUP BY indexrelid`
+	segmentIndexScansSql_V7 = `SELECT indexrelid, sum(idx_scan) idx_scan FROM gp_stat_user_indexes GROUP BY indexrelid`
+
+	indexSummarySql = `
+		SELECT count(*)
+			 , coalesce(sum(CASE WHEN s.idx_scan=0 AND d.idx_scan=0 AND NOT i.indisunique THEN pg_relation_size(i.indexrelid) ELSE 0 END),0)
+			 , sum(CASE WHEN i.indisvalid THEN 0 ELSE 1 END)
+		  FROM pg_index i
+		  JOIN pg_class c ON i.indexrelid=c.oid
+		  JOIN pg_namespace n ON c.relnamespace=n.oid
+		  LEFT JOIN pg_stat_user_indexes s ON s.indexrelid=i.indexrelid
+		  LEFT JOIN (%s) d ON d.indexrelid=i.indexrelid
+		WHERE n.nspname NOT IN ('pg_catalog','information_schema','gp_toolkit','pg_aoseg','pg_bitmapindex')
+		AND n.nspname NOT LIKE 'pg_toast%%'
+		AND n.nspname NOT LIKE 'pg_temp%%'
+		`
+	unusedIndexSql = `
+		SELECT s.schemaname, s.relname, s.indexrelname, pg_relation_size(s.indexrelid)
+		  FROM pg_stat_user_indexes s
+		  JOIN pg_index i ON s.indexrelid=i.indexrelid
+		  JOIN (%s) d ON d.indexrelid=s.indexrelid
+		WHERE s.idx_scan=0
+		AND d.idx_scan=0
+		AND NOT i.indisunique
+		ORDER BY 4 DESC
+		LIMIT $1
+		`
+)
+
+var (
+	indexCountDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemServer, "database_index_total_count"),
+		"Total index count of each database",
+		[]string{"dbname"},
+		nil,
+	)
+
+	unusedIndexBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemServer, "database_unused_index_bytes"),
+		"Total bytes of non-unique indexes that have never been scanned in each database",
+		[]string{"dbname"},
+		nil,
+	)
+
+	invalidIndexCountDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemServer, "database_invalid_index_count"),
+		"Number of invalid indexes in each database, usually left behind by a failed CREATE INDEX",
+		[]string{"dbname"},
+		nil,
+	)
+
+	unusedIndexDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemServer, "database_unused_index_size_bytes"),
+		"Size in bytes of the largest never scanned non-unique indexes in each database",
+		[]string{"dbname", "schema", "table", "index"},
+		nil,
+	)
+)
+
+func NewIndexUsageScraper(topN int) Scraper {
+	return indexUsageScraper{topN: topN}
+}
+
+type indexUsageScraper struct {
+	topN int
+}
+
+func (indexUsageScraper) Name() string {
+	return "index_usage_scraper"
+}
+
+func (indexUsageScraper) Requirements(ver int) Requirements {
+	// Greenplum 7起通过gp_stat_user_indexes汇总各segment上的索引扫描次数，更早的版本通过gp_dist_random读取
+	relations := []string{"pg_catalog.pg_index", "pg_catalog.pg_stat_user_indexes"}
+	if ver >= verGP7 {
+		relations = append(relations, "pg_catalog.gp_stat_user_indexes")
+	}
+
+	return Requirements{Relations: relations, Functions: []string{"pg_catalog.pg_relation_size"}}
+}
+
+func (s indexUsageScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
+	scansSql := segmentIndexScansSql
+	if ver >= verGP7 {
+		scansSql = segmentIndexScansSql_V7
+	}
+
+	return scrapeEachDatabase(db, func(dbname string, conn *sql.DB) error {
+		errS := scrapeIndexSummary(conn, dbname, scansSql, ch)
+		errU := scrapeUnusedIndexes(conn, dbname, scansSql, s.topN, ch)
+
+		return combineErr(errS, errU)
+	})
+}
+
+func scrapeIndexSummary(conn *sql.DB, dbname string, scansSql string, ch chan<- prometheus.Metric) error {
+	querySql := fmt.Sprintf(indexSummarySql, scansSql)
+	rows, err := conn.Query(querySql)
+	logger.Infof("Query Database: %s", querySql)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var total, unusedBytes float64
+		var invalid sql.NullFloat64
+
+		err = rows.Scan(&total, &unusedBytes, &invalid)
+		if err != nil {
+			return err
+		}
+
+		ch <- prometheus.MustNewConstMetric(indexCountDesc, prometheus.GaugeValue, total, dbname)
+		ch <- prometheus.MustNewConstMetric(unusedIndexBytesDesc, prometheus.GaugeValue, unusedBytes, dbname)
+		ch <- prometheus.MustNewConstMetric(invalidIndexCountDesc, prometheus.GaugeValue, invalid.Float64, dbname)
+	}
+
+	return rows.Err()
+}
+
+func scrapeUnusedIndexes(conn *sql.DB, dbname string, scansSql string, topN int, ch chan<- prometheus.Metric) error {
+	if topN <= 0 {
+		return nil
+	}
+
+	querySql := fmt.Sprintf(unusedIndexSql, scansSql)
+	rows, err := conn.Query(querySql, topN)
+	logger.Infof("Query Database: %s", querySql)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	errs := make([]error, 0)
+
+	for rows.Next() {
+		var schema, table, index string
+		var size float64
+
+		err = rows.Scan(&schema, &table, &index, &size)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(unusedIndexDesc, prometheus.GaugeValue, size, dbname, schema, table, index)
+	}
+
+	return combineErr(errs...)
+}
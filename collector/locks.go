@@ -39,6 +39,33 @@ const (
 		pg_stat_activity.application_name, state , lock_satus ,pg_stat_activity.query, start_time
 		ORDER BY start_time
 		`
+	locksQuerySql_V7 = ` 
+		SELECT pg_locks.pid
+			 , pg_database.datname
+			 , pg_stat_activity.usename
+			 , locktype
+			 , mode
+			 , pg_stat_activity.application_name
+			 , state
+			 , CASE
+						WHEN granted='f' THEN
+							'wait_lock'
+						WHEN granted='t' THEN
+							'get_lock'
+					END lock_satus
+			 , pg_stat_activity.query
+			 , least(query_start,xact_start) start_time
+			 , count(*)::float
+		  FROM pg_locks
+		  JOIN pg_database ON pg_locks.database=pg_database.oid
+		  JOIN pg_stat_activity on pg_locks.pid=pg_stat_activity.pid
+		WHERE NOT pg_locks.pid=pg_backend_pid()
+		AND pg_stat_activity.application_name<>'pg_statsinfod'
+		AND pg_stat_activity.backend_type='client backend'
+		GROUP BY pg_locks.pid, pg_database.datname,pg_stat_activity.usename, locktype, mode,
+		pg_stat_activity.application_name, state , lock_satus ,pg_stat_activity.query, start_time
+		ORDER BY start_time
+		`
 	locksQuerySql_V5 = ` 
 		SELECT pg_locks.pid
 			 , pg_database.datname
@@ -46,7 +73,14 @@ const (
 			 , locktype
 			 , mode
 			 , pg_stat_activity.application_name
-			 , 'unkown' as state
+			 , CASE
+						WHEN current_query='<IDLE>' THEN
+							'idle'
+						WHEN current_query LIKE '<IDLE> in transaction%' THEN
+							'idle in transaction'
+						ELSE
+							'active'
+					END as state
 			 , CASE
 						WHEN granted='f' THEN
 							'wait_lock'
@@ -86,9 +120,15 @@ func (locksScraper) Name() string {
 	return "locks_scraper"
 }
 
+func (locksScraper) Requirements(ver int) Requirements {
+	return Requirements{AllStats: true}
+}
+
 func (locksScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
 	querySql := locksQuerySql_V6
-	if ver < 6 {
+	if ver >= verGP7 {
+		querySql = locksQuerySql_V7
+	} else if ver < verGP6 {
 		querySql = locksQuerySql_V5
 	}
 
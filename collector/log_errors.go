@@ -0,0 +1,191 @@
+package collector
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	logger "github.com/prometheus/common/log"
+)
+
+/**
+ *  服务器日志错误抓取器
+ *  读取gp_toolkit.gp_log_system（或gp_log_database）中ERROR/FATAL/PANIC级别的日志，
+ *  按级别、SQLSTATE、数据库、segment累计计数，并单独统计内存不足、磁盘空间不足、interconnect错误。
+ *  segment的日志可能晚于其logtime写入，每次从已读取日志的最大时间往前回退logErrorsLag开始读取，
+ *  按logtime、segment、进程号与日志内容的摘要去重，保证同一条日志不会重复计数，晚于logErrorsLag写入的日志仍会漏计；
+ *  每次最多回溯一个时间窗口，避免exporter长时间停止后一次读取过多日志
+ */
+
+const (
+	logErrorsSql = `
+		SELECT logtime::text
+			 , extract(epoch from logtime)
+			 , coalesce(logsegment,'')
+			 , coalesce(logpid,'')
+			 , md5(coalesce(logmessage,''))
+			 , logseverity
+			 , coalesce(logstate,'')
+			 , coalesce(logdatabase,'')
+			 , CASE
+					WHEN logstate='53200' THEN 'out_of_memory'
+					WHEN logstate='53100' OR logmessage LIKE '%%No space left on device%%' THEN 'out_of_disk'
+					WHEN logmessage ILIKE '%%interconnect%%' THEN 'interconnect'
+					ELSE ''
+				END category
+			 , count(*)
+		  FROM gp_toolkit.%s
+		WHERE logtime > greatest(to_timestamp($1), now() - $2::interval)
+		AND logseverity IN ('ERROR','FATAL','PANIC')
+		GROUP BY 1,2,3,4,5,6,7,8,9
+		`
+)
+
+// 每次读取日志时从水位线往前回退的时长，容忍segment日志的延迟写入
+const logErrorsLag = 2 * time.Minute
+
+// 标识一条日志，同一毫秒内同一进程输出的相同日志合并计数
+type logErrorKey struct {
+	logTime, segment, pid, messageHash string
+	severity, sqlState, dbname         string
+	category                           string
+}
+
+type logErrorRow struct {
+	key   logErrorKey
+	epoch float64
+	count float64
+}
+
+// 回退区间内已计数的日志
+type logErrorSeen struct {
+	epoch float64
+	count float64
+}
+
+func NewLogErrorsScraper(view string, window time.Duration) Scraper {
+	return &logErrorsScraper{
+		view:   view,
+		window: window,
+		seen:   make(map[logErrorKey]logErrorSeen),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subSystemServer,
+			Name:      "log_errors_total",
+			Help:      "Number of ERROR, FATAL and PANIC entries in the greenplum server log",
+		}, []string{"severity", "sqlstate", "dbname", "segment"}),
+		classified: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subSystemServer,
+			Name:      "log_classified_errors_total",
+			Help:      "Number of out of memory, out of disk and interconnect errors in the greenplum server log",
+		}, []string{"category", "segment"}),
+	}
+}
+
+type logErrorsScraper struct {
+	mu     sync.Mutex
+	view   string
+	window time.Duration
+
+	// 已读取日志的最大logtime，以及logtime晚于watermark-logErrorsLag的已计数日志
+	watermark float64
+	seen      map[logErrorKey]logErrorSeen
+
+	errors     *prometheus.CounterVec
+	classified *prometheus.CounterVec
+}
+
+func (*logErrorsScraper) Name() string {
+	return "log_errors_scraper"
+}
+
+func (s *logErrorsScraper) Requirements(ver int) Requirements {
+	return Requirements{Relations: []string{"gp_toolkit." + s.view}}
+}
+
+func (s *logErrorsScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.scrapeNewLogs(db)
+
+	s.errors.Collect(ch)
+	s.classified.Collect(ch)
+
+	return err
+}
+
+func (s *logErrorsScraper) scrapeNewLogs(db *sql.DB) error {
+	querySql := fmt.Sprintf(logErrorsSql, s.view)
+	window := fmt.Sprintf("%d seconds", int64(s.window.Seconds()))
+
+	rows, err := db.Query(querySql, s.watermark-logErrorsLag.Seconds(), window)
+	logger.Infof("Query Database: %s", querySql)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	errs := make([]error, 0)
+
+	logs := make([]logErrorRow, 0)
+	for rows.Next() {
+		var row logErrorRow
+		k := &row.key
+
+		err = rows.Scan(&k.logTime, &row.epoch, &k.segment, &k.pid, &k.messageHash, &k.severity, &k.sqlState, &k.dbname, &k.category, &row.count)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		logs = append(logs, row)
+	}
+
+	// 读取不完整时不计数也不推进水位线，下次重新读取
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	s.countNewLogs(logs)
+
+	return combineErr(errs...)
+}
+
+/**
+* 函数：countNewLogs
+* 功能：累计尚未计数的日志，推进水位线并丢弃回退区间之前的去重记录
+ */
+func (s *logErrorsScraper) countNewLogs(logs []logErrorRow) {
+	for _, row := range logs {
+		k := row.key
+
+		// 同一毫秒内同一进程的相同日志可能分多次写入，只累计新增的条数
+		if seen, ok := s.seen[k]; !ok || row.count > seen.count {
+			added := row.count - seen.count
+
+			s.errors.WithLabelValues(k.severity, k.sqlState, k.dbname, k.segment).Add(added)
+			if k.category != "" {
+				s.classified.WithLabelValues(k.category, k.segment).Add(added)
+			}
+
+			s.seen[k] = logErrorSeen{epoch: row.epoch, count: row.count}
+		}
+
+		if row.epoch > s.watermark {
+			s.watermark = row.epoch
+		}
+	}
+
+	since := s.watermark - logErrorsLag.Seconds()
+	for k, seen := range s.seen {
+		if seen.epoch <= since {
+			delete(s.seen, k)
+		}
+	}
+}
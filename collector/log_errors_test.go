@@ -0,0 +1,59 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCountNewLogs(t *testing.T) {
+	s := NewLogErrorsScraper("gp_log_system", 5*time.Minute).(*logErrorsScraper)
+
+	row := func(logTime string, epoch float64, pid, category string, count float64) logErrorRow {
+		return logErrorRow{
+			key:   logErrorKey{logTime: logTime, segment: "seg0", pid: pid, messageHash: "h", severity: "ERROR", sqlState: "53200", dbname: "db", category: category},
+			epoch: epoch,
+			count: count,
+		}
+	}
+	a := row("10:00:00.001", 1000, "p1", "out_of_memory", 1)
+	b := row("10:00:01.000", 1001, "p2", "", 2)
+
+	tests := []struct {
+		name       string
+		logs       []logErrorRow
+		errors     float64
+		classified float64
+		watermark  float64
+		seen       int
+	}{
+		{name: "first read", logs: []logErrorRow{a, b}, errors: 3, classified: 1, watermark: 1001, seen: 2},
+		{name: "read again", logs: []logErrorRow{a, b}, errors: 3, classified: 1, watermark: 1001, seen: 2},
+		{
+			// 同一条日志晚写入了一条，以及logtime早于水位线但在回退区间内的日志
+			name:       "late flushed logs",
+			logs:       []logErrorRow{a, row("10:00:01.000", 1001, "p2", "", 3), row("09:59:50.000", 990, "p3", "out_of_memory", 1)},
+			errors:     5,
+			classified: 2,
+			watermark:  1001,
+			seen:       3,
+		},
+		{name: "same logtime from another process", logs: []logErrorRow{row("10:00:01.000", 1001, "p4", "", 1)}, errors: 6, classified: 2, watermark: 1001, seen: 4},
+		{name: "watermark moves past the lag", logs: []logErrorRow{row("10:05:00.000", 1300, "p1", "", 1)}, errors: 7, classified: 2, watermark: 1300, seen: 1},
+	}
+
+	for _, test := range tests {
+		s.countNewLogs(test.logs)
+
+		if got := testutil.ToFloat64(s.errors.WithLabelValues("ERROR", "53200", "db", "seg0")); got != test.errors {
+			t.Errorf("%s: errors = %v, want %v", test.name, got, test.errors)
+		}
+		if got := testutil.ToFloat64(s.classified.WithLabelValues("out_of_memory", "seg0")); got != test.classified {
+			t.Errorf("%s: classified = %v, want %v", test.name, got, test.classified)
+		}
+		if s.watermark != test.watermark || len(s.seen) != test.seen {
+			t.Errorf("%s: watermark = %v with %d seen logs, want %v with %d", test.name, s.watermark, len(s.seen), test.watermark, test.seen)
+		}
+	}
+}
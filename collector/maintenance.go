@@ -0,0 +1,329 @@
+package collector
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	logger "github.com/prometheus/common/log"
+)
+
+/**
+ *  维护操作时效抓取器
+ *  基于pg_stat_last_operation按数据库统计从未ANALYZE/VACUUM过的用户表数量、超过指定时长未ANALYZE的用户表数量，
+ *  以及最近一段时间内执行过CREATE/ALTER/DROP的对象数量；
+ *  DROP会删除对象在pg_stat_last_operation中的记录，因此对比相邻两次抓取时有记录的对象，记录消失的对象计为在后一次抓取时被删除，
+ *  两次抓取之间创建又删除的对象无法统计
+ */
+
+const (
+	tableMaintenanceSql = `
+		SELECT extract(epoch from now() - max(CASE WHEN o.staactionname='ANALYZE' THEN o.statime END))
+			 , max(CASE WHEN o.staactionname='VACUUM' THEN o.statime END) IS NULL
+		  FROM pg_class c
+		  JOIN pg_namespace n ON c.relnamespace=n.oid
+		  LEFT JOIN pg_stat_last_operation o ON o.classid='pg_class'::regclass
+											AND o.objid=c.oid
+											AND o.staactionname IN ('ANALYZE','VACUUM')
+		WHERE c.relkind='r'
+		AND n.nspname NOT IN ('pg_catalog','information_schema','gp_toolkit','pg_aoseg','pg_bitmapindex')
+		AND n.nspname NOT LIKE 'pg_toast%'
+		AND n.nspname NOT LIKE 'pg_temp%'
+		GROUP BY c.oid
+		`
+	recentDdlSql = `
+		SELECT staactionname, coalesce(stasubtype,''), count(*)
+		  FROM pg_stat_last_operation
+		WHERE staactionname IN ('CREATE','ALTER')
+		AND statime > now() - $1::interval
+		GROUP BY 1,2
+		`
+	trackedObjectsSql = `
+		SELECT classid, objid, coalesce(max(CASE WHEN staactionname='CREATE' THEN stasubtype END),'')
+		  FROM pg_stat_last_operation
+		GROUP BY 1,2
+		`
+)
+
+var (
+	neverAnalyzedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemServer, "database_tables_never_analyzed"),
+		"Number of user tables that have never been analyzed in each database",
+		[]string{"dbname"},
+		nil,
+	)
+
+	neverVacuumedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemServer, "database_tables_never_vacuumed"),
+		"Number of user tables that have never been vacuumed in each database",
+		[]string{"dbname"},
+		nil,
+	)
+
+	notAnalyzedWithinDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemServer, "database_tables_not_analyzed_within"),
+		"Number of user tables not analyzed within the given age in each database, including tables never analyzed",
+		[]string{"dbname", "age"},
+		nil,
+	)
+
+	recentDdlDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemServer, "database_recent_ddl_objects"),
+		"Number of existing objects whose last CREATE or ALTER falls within the configured window, and of objects found dropped within the window, in each database",
+		[]string{"dbname", "action", "subtype"},
+		nil,
+	)
+)
+
+// pg_stat_last_operation中记录的对象
+type trackedObject struct {
+	classid, objid uint32
+}
+
+// 某次抓取时发现的按子类型统计的被删除对象数
+type droppedObjects struct {
+	at     time.Time
+	counts map[string]float64
+}
+
+// 每个数据库上一次抓取时有记录的对象及其子类型，以及时间窗口内发现的删除
+type ddlState struct {
+	objects map[trackedObject]string
+	drops   []droppedObjects
+}
+
+func NewMaintenanceScraper(analyzeAgeBuckets []time.Duration, ddlWindow time.Duration) Scraper {
+	return &maintenanceScraper{
+		analyzeAgeBuckets: analyzeAgeBuckets,
+		ddlWindow:         ddlWindow,
+		ddl:               make(map[string]*ddlState),
+	}
+}
+
+type maintenanceScraper struct {
+	analyzeAgeBuckets []time.Duration
+	ddlWindow         time.Duration
+
+	mu  sync.Mutex
+	ddl map[string]*ddlState
+}
+
+func (*maintenanceScraper) Name() string {
+	return "maintenance_scraper"
+}
+
+func (*maintenanceScraper) Requirements(ver int) Requirements {
+	return Requirements{Relations: []string{"pg_catalog.pg_stat_last_operation"}}
+}
+
+func (s *maintenanceScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scraped := make(map[string]bool)
+	err := scrapeEachDatabase(db, func(dbname string, conn *sql.DB) error {
+		scraped[dbname] = true
+
+		errT := s.scrapeTableMaintenance(conn, dbname, ch)
+		errD := s.scrapeRecentDdl(conn, dbname, ch)
+		errX := s.scrapeDroppedObjects(conn, dbname, ch)
+
+		return combineErr(errT, errD, errX)
+	})
+
+	// 数据库被删除后不再保留其对象记录
+	if err == nil {
+		for dbname := range s.ddl {
+			if !scraped[dbname] {
+				delete(s.ddl, dbname)
+			}
+		}
+	}
+
+	return err
+}
+
+func (s *maintenanceScraper) scrapeTableMaintenance(conn *sql.DB, dbname string, ch chan<- prometheus.Metric) error {
+	rows, err := conn.Query(tableMaintenanceSql)
+	logger.Infof("Query Database: %s", tableMaintenanceSql)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	var neverAnalyzed, neverVacuumed float64
+	notAnalyzed := make([]float64, len(s.analyzeAgeBuckets))
+	for rows.Next() {
+		var analyzeAge sql.NullFloat64
+		var vacuumMissing bool
+
+		if err = rows.Scan(&analyzeAge, &vacuumMissing); err != nil {
+			return err
+		}
+
+		if !analyzeAge.Valid {
+			neverAnalyzed++
+		}
+
+		if vacuumMissing {
+			neverVacuumed++
+		}
+
+		for i, bucket := range s.analyzeAgeBuckets {
+			if !analyzeAge.Valid || analyzeAge.Float64 > bucket.Seconds() {
+				notAnalyzed[i]++
+			}
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	ch <- prometheus.MustNewConstMetric(neverAnalyzedDesc, prometheus.GaugeValue, neverAnalyzed, dbname)
+	ch <- prometheus.MustNewConstMetric(neverVacuumedDesc, prometheus.GaugeValue, neverVacuumed, dbname)
+
+	for i, bucket := range s.analyzeAgeBuckets {
+		ch <- prometheus.MustNewConstMetric(notAnalyzedWithinDesc, prometheus.GaugeValue, notAnalyzed[i], dbname, model.Duration(bucket).String())
+	}
+
+	return nil
+}
+
+func (s *maintenanceScraper) scrapeRecentDdl(conn *sql.DB, dbname string, ch chan<- prometheus.Metric) error {
+	window := fmt.Sprintf("%d seconds", int64(s.ddlWindow.Seconds()))
+
+	rows, err := conn.Query(recentDdlSql, window)
+	logger.Infof("Query Database: %s", recentDdlSql)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	errs := make([]error, 0)
+
+	for rows.Next() {
+		var action, subtype string
+		var count float64
+
+		err = rows.Scan(&action, &subtype, &count)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(recentDdlDesc, prometheus.GaugeValue, count, dbname, action, subtype)
+	}
+
+	return combineErr(errs...)
+}
+
+/**
+* 函数：scrapeDroppedObjects
+* 功能：对比上一次抓取时有记录的对象，输出时间窗口内发现的按子类型统计的被删除对象数
+ */
+func (s *maintenanceScraper) scrapeDroppedObjects(conn *sql.DB, dbname string, ch chan<- prometheus.Metric) error {
+	objects, err := queryTrackedObjects(conn)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	state, ok := s.ddl[dbname]
+	if !ok {
+		state = &ddlState{}
+		s.ddl[dbname] = state
+	} else if counts := droppedSince(state.objects, objects); len(counts) > 0 {
+		state.drops = append(state.drops, droppedObjects{at: now, counts: counts})
+	}
+
+	state.objects = objects
+	state.drops = pruneDrops(state.drops, now.Add(-s.ddlWindow))
+
+	for subtype, count := range sumDrops(state.drops) {
+		ch <- prometheus.MustNewConstMetric(recentDdlDesc, prometheus.GaugeValue, count, dbname, "DROP", subtype)
+	}
+
+	return nil
+}
+
+func queryTrackedObjects(conn *sql.DB) (map[trackedObject]string, error) {
+	rows, err := conn.Query(trackedObjectsSql)
+	logger.Infof("Query Database: %s", trackedObjectsSql)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	// 子类型只有少数几种，复用相同的字符串以减少内存
+	subtypes := make(map[string]string)
+	objects := make(map[trackedObject]string)
+	for rows.Next() {
+		var object trackedObject
+		var subtype string
+
+		if err = rows.Scan(&object.classid, &object.objid, &subtype); err != nil {
+			return nil, err
+		}
+
+		if interned, ok := subtypes[subtype]; ok {
+			subtype = interned
+		} else {
+			subtypes[subtype] = subtype
+		}
+
+		objects[object] = subtype
+	}
+
+	return objects, rows.Err()
+}
+
+/**
+* 函数：droppedSince
+* 功能：统计上一次抓取时有记录、本次已没有记录的对象，按子类型计数
+ */
+func droppedSince(previous, current map[trackedObject]string) map[string]float64 {
+	counts := make(map[string]float64)
+	for object, subtype := range previous {
+		if _, ok := current[object]; !ok {
+			counts[subtype]++
+		}
+	}
+
+	return counts
+}
+
+/**
+* 函数：pruneDrops
+* 功能：丢弃时间窗口之前发现的删除
+ */
+func pruneDrops(drops []droppedObjects, since time.Time) []droppedObjects {
+	kept := drops[:0]
+	for _, drop := range drops {
+		if drop.at.After(since) {
+			kept = append(kept, drop)
+		}
+	}
+
+	return kept
+}
+
+func sumDrops(drops []droppedObjects) map[string]float64 {
+	counts := make(map[string]float64)
+	for _, drop := range drops {
+		for subtype, count := range drop.counts {
+			counts[subtype] += count
+		}
+	}
+
+	return counts
+}
@@ -0,0 +1,61 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDroppedSince(t *testing.T) {
+	previous := map[trackedObject]string{
+		{1259, 16384}: "TABLE",
+		{1259, 16390}: "TABLE",
+		{1259, 16400}: "INDEX",
+		{2615, 16500}: "SCHEMA",
+		{1259, 16600}: "",
+	}
+
+	tests := []struct {
+		name    string
+		current map[trackedObject]string
+		want    map[string]float64
+	}{
+		{name: "nothing dropped", current: previous, want: map[string]float64{}},
+		{
+			name:    "table and schema dropped, new table created",
+			current: map[trackedObject]string{{1259, 16390}: "TABLE", {1259, 16400}: "INDEX", {1259, 16700}: "TABLE", {1259, 16600}: ""},
+			want:    map[string]float64{"TABLE": 1, "SCHEMA": 1},
+		},
+		{name: "everything dropped", current: map[trackedObject]string{}, want: map[string]float64{"TABLE": 2, "INDEX": 1, "SCHEMA": 1, "": 1}},
+	}
+
+	for _, test := range tests {
+		got := droppedSince(previous, test.current)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: droppedSince() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPruneDrops(t *testing.T) {
+	now := time.Now()
+	drops := []droppedObjects{
+		{at: now.Add(-3 * time.Hour), counts: map[string]float64{"TABLE": 5}},
+		{at: now.Add(-time.Hour), counts: map[string]float64{"TABLE": 2, "INDEX": 1}},
+		{at: now, counts: map[string]float64{"TABLE": 1}},
+	}
+
+	kept := pruneDrops(drops, now.Add(-2*time.Hour))
+	if len(kept) != 2 {
+		t.Fatalf("got %d drops, want 2", len(kept))
+	}
+
+	want := map[string]float64{"TABLE": 3, "INDEX": 1}
+	if got := sumDrops(kept); !reflect.DeepEqual(got, want) {
+		t.Errorf("sumDrops() = %v, want %v", got, want)
+	}
+
+	if got := pruneDrops(kept, now.Add(time.Second)); len(got) != 0 {
+		t.Errorf("pruneDrops() kept %d drops after the window, want 0", len(got))
+	}
+}
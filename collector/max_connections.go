@@ -10,11 +10,36 @@ import (
 
 /**
  *  最大连接抓取器
+ *  除集群最大连接数外，结合pg_database.datconnlimit、pg_roles.rolconnlimit与pg_stat_activity中的会话数，
+ *  统计设置了连接上限的数据库与角色的连接使用率，以及非超级用户仍可使用的连接槽位
  */
 
 const (
 	maxConnectionsSql = `show max_connections`
 	suReservedSql     = `show superuser_reserved_connections`
+	backendsSql       = `select count(*) from pg_stat_activity`
+	backendsSql_V7    = `select count(*) from pg_stat_activity where backend_type='client backend'`
+
+	databaseConnLimitSql = `
+		SELECT d.datname, d.datconnlimit, coalesce(a.cnt,0)
+		  FROM pg_database d
+		  LEFT JOIN (
+			SELECT datname, count(*) cnt
+			  FROM pg_stat_activity
+			GROUP BY 1
+		  ) a ON a.datname=d.datname
+		WHERE d.datconnlimit >= 0
+		`
+	roleConnLimitSql = `
+		SELECT r.rolname, r.rolconnlimit, coalesce(a.cnt,0)
+		  FROM pg_roles r
+		  LEFT JOIN (
+			SELECT usename, count(*) cnt
+			  FROM pg_stat_activity
+			GROUP BY 1
+		  ) a ON a.usename=r.rolname
+		WHERE r.rolconnlimit >= 0
+		`
 )
 
 var (
@@ -23,6 +48,48 @@ var (
 		"Max connection of greenPlum cluster",
 		nil, nil,
 	)
+
+	availableConnDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemCluster, "available_connections"),
+		"Connection slots still available to non-superusers, max_connections minus superuser_reserved_connections minus current backends",
+		nil, nil,
+	)
+
+	databaseConnLimitDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemCluster, "database_connection_limit"),
+		"Connection limit of the database, only databases with datconnlimit set are reported",
+		[]string{"dbname"}, nil,
+	)
+
+	databaseConnectionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemCluster, "database_connections"),
+		"Current connections to the database having a connection limit",
+		[]string{"dbname"}, nil,
+	)
+
+	databaseConnUtilizationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemCluster, "database_connections_utilization_ratio"),
+		"Ratio of current connections to the connection limit of the database",
+		[]string{"dbname"}, nil,
+	)
+
+	roleConnLimitDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemCluster, "role_connection_limit"),
+		"Connection limit of the role, only roles with rolconnlimit set are reported",
+		[]string{"usename"}, nil,
+	)
+
+	roleConnectionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemCluster, "role_connections"),
+		"Current connections of the role having a connection limit",
+		[]string{"usename"}, nil,
+	)
+
+	roleConnUtilizationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemCluster, "role_connections_utilization_ratio"),
+		"Ratio of current connections to the connection limit of the role",
+		[]string{"usename"}, nil,
+	)
 )
 
 func NewMaxConnScraper() Scraper {
@@ -35,6 +102,10 @@ func (maxConnScraper) Name() string {
 	return "max_connection_scraper"
 }
 
+func (maxConnScraper) Requirements(ver int) Requirements {
+	return Requirements{Relations: []string{"pg_catalog.pg_stat_activity", "pg_catalog.pg_database", "pg_catalog.pg_roles"}}
+}
+
 func (maxConnScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
 	maxConn, err := showConnections(db, maxConnectionsSql)
 
@@ -51,7 +122,63 @@ func (maxConnScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver int) e
 	//这里的最大连接数应为max_connections减去superuser_reserved_connections
 	ch <- prometheus.MustNewConstMetric(maxConnDesc, prometheus.GaugeValue, maxConn-reserved)
 
-	return nil
+	errs := make([]error, 0)
+
+	querySql := backendsSql
+	if ver >= verGP7 {
+		querySql = backendsSql_V7
+	}
+
+	backends, err := showConnections(db, querySql)
+	if err != nil {
+		errs = append(errs, err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(availableConnDesc, prometheus.GaugeValue, maxConn-reserved-backends)
+	}
+
+	errD := scrapeConnLimit(db, databaseConnLimitSql, databaseConnLimitDesc, databaseConnectionsDesc, databaseConnUtilizationDesc, ch)
+	errR := scrapeConnLimit(db, roleConnLimitSql, roleConnLimitDesc, roleConnectionsDesc, roleConnUtilizationDesc, ch)
+	errs = append(errs, errD, errR)
+
+	return combineErr(errs...)
+}
+
+/**
+* 函数：scrapeConnLimit
+* 功能：读取设置了连接上限的数据库或角色的上限与当前连接数，输出上限、连接数与使用率
+ */
+func scrapeConnLimit(db *sql.DB, querySql string, limitDesc, connDesc, ratioDesc *prometheus.Desc, ch chan<- prometheus.Metric) error {
+	rows, err := db.Query(querySql)
+	logger.Infof("Query Database: %s", querySql)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	errs := make([]error, 0)
+
+	for rows.Next() {
+		var name string
+		var limit, conn float64
+
+		err = rows.Scan(&name, &limit, &conn)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(limitDesc, prometheus.GaugeValue, limit, name)
+		ch <- prometheus.MustNewConstMetric(connDesc, prometheus.GaugeValue, conn, name)
+
+		// 上限为0时禁止连接，使用率无意义
+		if limit > 0 {
+			ch <- prometheus.MustNewConstMetric(ratioDesc, prometheus.GaugeValue, conn/limit, name)
+		}
+	}
+
+	return combineErr(errs...)
 }
 
 func showConnections(db *sql.DB, sql string) (conn float64, err error) {
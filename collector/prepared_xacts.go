@@ -0,0 +1,129 @@
+package collector
+
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+	logger "github.com/prometheus/common/log"
+)
+
+/**
+ *  两阶段提交事务抓取器
+ *  master崩溃于提交过程中时，segment上可能遗留预备事务，阻塞vacuum并持有锁；
+ *  统计master及每个primary segment上预备事务的数量与最老的存在时长，以及各状态的分布式事务数量
+ */
+
+const (
+	preparedXactsSql = `
+		SELECT c.content, c.hostname, coalesce(x.cnt,0), coalesce(x.oldest,0)
+		  FROM gp_segment_configuration c
+		  LEFT JOIN (
+			SELECT -1 segid, count(*) cnt, extract(epoch from now() - min(prepared)) oldest
+			  FROM pg_prepared_xacts
+			UNION ALL
+			SELECT gp_execution_segment(), count(*), extract(epoch from now() - min(prepared))
+			  FROM gp_dist_random('pg_prepared_xacts')
+			GROUP BY 1
+		  ) x ON x.segid=c.content
+		WHERE c.role='p'
+		`
+	distributedXactsSql = `SELECT state, count(*) from gp_distributed_xacts group by 1`
+)
+
+var (
+	preparedXactsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemNode, "segment_prepared_xacts"),
+		"Number of prepared transactions on master and each primary segment",
+		[]string{"hostname", "content"}, nil,
+	)
+
+	preparedXactOldestDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemNode, "segment_prepared_xact_oldest_age_seconds"),
+		"Age in seconds of the oldest prepared transaction on master and each primary segment",
+		[]string{"hostname", "content"}, nil,
+	)
+
+	distributedXactsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemCluster, "distributed_xacts"),
+		"Number of distributed transactions in each state",
+		[]string{"state"}, nil,
+	)
+)
+
+func NewPreparedXactsScraper() Scraper {
+	return preparedXactsScraper{}
+}
+
+type preparedXactsScraper struct{}
+
+func (preparedXactsScraper) Name() string {
+	return "prepared_xacts_scraper"
+}
+
+func (preparedXactsScraper) Requirements(ver int) Requirements {
+	return Requirements{Relations: []string{"pg_catalog.pg_prepared_xacts", "pg_catalog.gp_distributed_xacts"}, Functions: []string{"pg_catalog.gp_execution_segment"}}
+}
+
+func (preparedXactsScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
+	errP := scrapePreparedXacts(db, ch)
+	errD := scrapeDistributedXacts(db, ch)
+
+	return combineErr(errP, errD)
+}
+
+func scrapePreparedXacts(db *sql.DB, ch chan<- prometheus.Metric) error {
+	rows, err := db.Query(preparedXactsSql)
+	logger.Infof("Query Database: %s", preparedXactsSql)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	errs := make([]error, 0)
+
+	for rows.Next() {
+		var content, hostname string
+		var count, oldest float64
+
+		err = rows.Scan(&content, &hostname, &count, &oldest)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(preparedXactsDesc, prometheus.GaugeValue, count, hostname, content)
+		ch <- prometheus.MustNewConstMetric(preparedXactOldestDesc, prometheus.GaugeValue, oldest, hostname, content)
+	}
+
+	return combineErr(errs...)
+}
+
+func scrapeDistributedXacts(db *sql.DB, ch chan<- prometheus.Metric) error {
+	rows, err := db.Query(distributedXactsSql)
+	logger.Infof("Query Database: %s", distributedXactsSql)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	errs := make([]error, 0)
+
+	for rows.Next() {
+		var state string
+		var count float64
+
+		err = rows.Scan(&state, &count)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(distributedXactsDesc, prometheus.GaugeValue, count, state)
+	}
+
+	return combineErr(errs...)
+}
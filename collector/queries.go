@@ -12,7 +12,6 @@ import (
  */
 
 const (
-	//?????????????????????????????????????
 	queriesSql = `select * from database_now;`
 )
 
@@ -46,7 +45,28 @@ func (queriesScraper) Name() string {
 	return "queriesScraper"
 }
 
+func (queriesScraper) Requirements(ver int) Requirements {
+	return Requirements{MaxVersion: verGP6, GpperfmonRelations: []string{"public.database_now"}}
+}
+
 func (queriesScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
+	perfmonDB, err := gpperfmon.connect(db)
+	if err != nil {
+		return err
+	}
+
+	if perfmonDB == nil {
+		logger.Warn("gpperfmon is not installed, skip scraping database_now")
+		return nil
+	}
+
+	errA := scrapeGpperfmonDataAge(perfmonDB, "database_now", ch)
+	errS := scrapeDatabaseNow(perfmonDB, ch)
+
+	return combineErr(errS, errA)
+}
+
+func scrapeDatabaseNow(db *sql.DB, ch chan<- prometheus.Metric) error {
 	rows, err := db.Query(queriesSql)
 	logger.Infof("Query Database: %s",queriesSql)
 
@@ -0,0 +1,164 @@
+package collector
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	logger "github.com/prometheus/common/log"
+)
+
+/**
+ *  历史查询耗时抓取器
+ *  每次抓取只读取gpperfmon库queries_history表中上次水位线之后新增的记录，
+ *  累计为按数据库、用户、最终状态划分的执行耗时、排队等待时间、CPU时间直方图
+ */
+
+const (
+	queriesHistoryWatermarkSql = `SELECT coalesce(max(ctime), now()::timestamp)::text from queries_history`
+	queriesHistorySql          = `
+		SELECT ctime::text
+			 , coalesce(db,'')
+			 , coalesce(username,'')
+			 , lower(coalesce(status,''))
+			 , coalesce(extract(epoch from tfinish - tstart),0)
+			 , coalesce(extract(epoch from tstart - tsubmit),0)
+			 , coalesce(cpu_elapsed,0)
+		  FROM queries_history
+		WHERE ctime > $1::timestamp
+		ORDER BY ctime
+		`
+)
+
+var queryHistoryBuckets = []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600, 1800, 3600}
+
+func NewQueriesHistoryScraper() Scraper {
+	labels := []string{"dbname", "usename", "status"}
+
+	return &queriesHistoryScraper{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subSystemCluster,
+			Name:      "query_duration_seconds",
+			Help:      "Execution time of finished queries recorded in gpperfmon queries_history",
+			Buckets:   queryHistoryBuckets,
+		}, labels),
+		queueWait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subSystemCluster,
+			Name:      "query_queue_wait_seconds",
+			Help:      "Time finished queries waited between submit and start recorded in gpperfmon queries_history",
+			Buckets:   queryHistoryBuckets,
+		}, labels),
+		cpuTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subSystemCluster,
+			Name:      "query_cpu_seconds",
+			Help:      "CPU time used by finished queries across all segments recorded in gpperfmon queries_history",
+			Buckets:   queryHistoryBuckets,
+		}, labels),
+	}
+}
+
+type queriesHistoryScraper struct {
+	mu        sync.Mutex
+	watermark string
+
+	duration  *prometheus.HistogramVec
+	queueWait *prometheus.HistogramVec
+	cpuTime   *prometheus.HistogramVec
+}
+
+func (*queriesHistoryScraper) Name() string {
+	return "queries_history_scraper"
+}
+
+func (*queriesHistoryScraper) Requirements(ver int) Requirements {
+	return Requirements{MaxVersion: verGP6, GpperfmonRelations: []string{"public.queries_history"}}
+}
+
+func (s *queriesHistoryScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	perfmonDB, err := gpperfmon.connect(db)
+	if err != nil {
+		return err
+	}
+
+	if perfmonDB == nil {
+		logger.Warn("gpperfmon is not installed, skip scraping queries_history")
+		return nil
+	}
+
+	// 首次抓取时从当前最新记录开始，不回溯历史数据
+	if s.watermark == "" {
+		if s.watermark, err = queryHistoryWatermark(perfmonDB); err != nil {
+			return err
+		}
+	}
+
+	err = s.scrapeNewQueries(perfmonDB)
+
+	s.duration.Collect(ch)
+	s.queueWait.Collect(ch)
+	s.cpuTime.Collect(ch)
+
+	return err
+}
+
+func (s *queriesHistoryScraper) scrapeNewQueries(db *sql.DB) error {
+	rows, err := db.Query(queriesHistorySql, s.watermark)
+	logger.Infof("Query Database: %s", queriesHistorySql)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	errs := make([]error, 0)
+
+	for rows.Next() {
+		var cTime, dbname, usename, status string
+		var duration, queueWait, cpuTime float64
+
+		err = rows.Scan(&cTime, &dbname, &usename, &status, &duration, &queueWait, &cpuTime)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		s.duration.WithLabelValues(dbname, usename, status).Observe(duration)
+		s.queueWait.WithLabelValues(dbname, usename, status).Observe(queueWait)
+		s.cpuTime.WithLabelValues(dbname, usename, status).Observe(cpuTime)
+
+		s.watermark = cTime
+	}
+
+	if err = rows.Err(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return combineErr(errs...)
+}
+
+func queryHistoryWatermark(db *sql.DB) (watermark string, err error) {
+	rows, err := db.Query(queriesHistoryWatermarkSql)
+	logger.Infof("Query Database: %s", queriesHistoryWatermarkSql)
+
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		err = rows.Scan(&watermark)
+		return
+	}
+
+	err = errors.New("watermark of queries_history not found")
+	return
+}
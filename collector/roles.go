@@ -0,0 +1,219 @@
+package collector
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	logger "github.com/prometheus/common/log"
+)
+
+/**
+ *  角色清单与安全状况抓取器
+ *  基于pg_authid统计超级用户、可登录角色、无密码的可登录角色、密码即将过期或已过期的角色、
+ *  拥有创建外部表权限的非超级用户角色的数量；仅对显式允许的角色输出带角色名标签的指标
+ */
+
+const (
+	rolesSummarySql = `
+		SELECT count(*)
+			 , sum(CASE WHEN rolsuper THEN 1 ELSE 0 END)
+			 , sum(CASE WHEN rolcanlogin THEN 1 ELSE 0 END)
+			 , sum(CASE WHEN rolcanlogin AND rolpassword IS NULL THEN 1 ELSE 0 END)
+			 , sum(CASE WHEN rolcanlogin AND rolvaliduntil > now() AND rolvaliduntil <= now() + $1::interval THEN 1 ELSE 0 END)
+			 , sum(CASE WHEN rolcanlogin AND rolvaliduntil <= now() THEN 1 ELSE 0 END)
+			 , sum(CASE WHEN NOT rolsuper AND (rolcreaterextgpfd OR rolcreaterexthttp OR rolcreatewextgpfd) THEN 1 ELSE 0 END)
+		  FROM pg_authid
+		`
+	roleDetailSql = `
+		SELECT r.rolname
+			 , r.rolsuper
+			 , r.rolcanlogin
+			 , extract(epoch from r.rolvaliduntil)
+			 , (SELECT count(*) FROM gp_toolkit.gp_roles_assigned a WHERE a.raroleid=r.oid)
+		  FROM pg_roles r
+		WHERE r.rolname = ANY($1)
+		`
+)
+
+var (
+	usersCountDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemServer, "users_total_count"),
+		"Total user account number for current greenplum database",
+		nil,
+		nil,
+	)
+
+	rolesCountDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemServer, "roles_total_count"),
+		"Total number of roles, including roles that can not login",
+		nil,
+		nil,
+	)
+
+	superuserCountDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemServer, "roles_superuser_count"),
+		"Number of superuser roles",
+		nil,
+		nil,
+	)
+
+	noPasswordCountDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemServer, "roles_without_password_count"),
+		"Number of login roles without a password",
+		nil,
+		nil,
+	)
+
+	expiringCountDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemServer, "roles_password_expiring_count"),
+		"Number of login roles whose password expires within the configured days",
+		nil,
+		nil,
+	)
+
+	expiredCountDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemServer, "roles_password_expired_count"),
+		"Number of login roles whose password has already expired",
+		nil,
+		nil,
+	)
+
+	createExtTableCountDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemServer, "roles_create_external_table_count"),
+		"Number of non-superuser roles with CREATEEXTTABLE privileges",
+		nil,
+		nil,
+	)
+
+	roleSuperuserDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemServer, "role_superuser"),
+		"Whether the explicitly allowed role is a superuser",
+		[]string{"rolname"},
+		nil,
+	)
+
+	roleLoginDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemServer, "role_login"),
+		"Whether the explicitly allowed role can login",
+		[]string{"rolname"},
+		nil,
+	)
+
+	roleValidUntilDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemServer, "role_valid_until_timestamp_seconds"),
+		"Password expiry time of the explicitly allowed role",
+		[]string{"rolname"},
+		nil,
+	)
+
+	roleMembersDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemServer, "role_members_count"),
+		"Number of members granted the explicitly allowed role",
+		[]string{"rolname"},
+		nil,
+	)
+)
+
+func NewRolesScraper(allowedRoles []string, expiryDays int) Scraper {
+	return &rolesScraper{allowedRoles: allowedRoles, expiryDays: expiryDays}
+}
+
+type rolesScraper struct {
+	allowedRoles []string
+	expiryDays   int
+}
+
+func (rolesScraper) Name() string {
+	return "roles_scraper"
+}
+
+func (rolesScraper) Requirements(ver int) Requirements {
+	return Requirements{Relations: []string{"pg_catalog.pg_authid", "gp_toolkit.gp_roles_assigned"}}
+}
+
+func (s rolesScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
+	errS := scrapeRolesSummary(db, s.expiryDays, ch)
+	errD := scrapeRoleDetail(db, s.allowedRoles, ch)
+
+	return combineErr(errS, errD)
+}
+
+func scrapeRolesSummary(db *sql.DB, expiryDays int, ch chan<- prometheus.Metric) error {
+	rows, err := db.Query(rolesSummarySql, fmt.Sprintf("%d days", expiryDays))
+	logger.Infof("Query Database: %s", rolesSummarySql)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var total, superuser, login, noPassword, expiring, expired, createExtTable float64
+
+		err = rows.Scan(&total, &superuser, &login, &noPassword, &expiring, &expired, &createExtTable)
+		if err != nil {
+			return err
+		}
+
+		ch <- prometheus.MustNewConstMetric(usersCountDesc, prometheus.GaugeValue, login)
+		ch <- prometheus.MustNewConstMetric(rolesCountDesc, prometheus.GaugeValue, total)
+		ch <- prometheus.MustNewConstMetric(superuserCountDesc, prometheus.GaugeValue, superuser)
+		ch <- prometheus.MustNewConstMetric(noPasswordCountDesc, prometheus.GaugeValue, noPassword)
+		ch <- prometheus.MustNewConstMetric(expiringCountDesc, prometheus.GaugeValue, expiring)
+		ch <- prometheus.MustNewConstMetric(expiredCountDesc, prometheus.GaugeValue, expired)
+		ch <- prometheus.MustNewConstMetric(createExtTableCountDesc, prometheus.GaugeValue, createExtTable)
+	}
+
+	return rows.Err()
+}
+
+func scrapeRoleDetail(db *sql.DB, allowedRoles []string, ch chan<- prometheus.Metric) error {
+	if len(allowedRoles) == 0 {
+		return nil
+	}
+
+	rows, err := db.Query(roleDetailSql, pq.Array(allowedRoles))
+	logger.Infof("Query Database: %s", roleDetailSql)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	errs := make([]error, 0)
+
+	for rows.Next() {
+		var rolname string
+		var superuser, login bool
+		var validUntil sql.NullFloat64
+		var members float64
+
+		err = rows.Scan(&rolname, &superuser, &login, &validUntil, &members)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(roleSuperuserDesc, prometheus.GaugeValue, boolToFloat(superuser), rolname)
+		ch <- prometheus.MustNewConstMetric(roleLoginDesc, prometheus.GaugeValue, boolToFloat(login), rolname)
+		ch <- prometheus.MustNewConstMetric(roleMembersDesc, prometheus.GaugeValue, members, rolname)
+
+		if validUntil.Valid {
+			ch <- prometheus.MustNewConstMetric(roleValidUntilDesc, prometheus.GaugeValue, validUntil.Float64, rolname)
+		}
+	}
+
+	return combineErr(errs...)
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
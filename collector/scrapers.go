@@ -2,6 +2,8 @@ package collector
 
 import (
 	"database/sql"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -17,3 +19,16 @@ type Scraper interface {
 	// 从数据库连接中获取数据信息，并发送到数据类型为prometheus metric的通道里.
 	Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver int) error
 }
+
+// 后台采样器Sampler接口定义
+// 采集器为每个Sampler启动后台协程，按Interval使用共享的数据库连接调用Sample，
+// 采样累计的结果仍通过Scrape随每次抓取输出
+type Sampler interface {
+	Scraper
+
+	// 两次采样之间的间隔.
+	Interval() time.Duration
+
+	// 从数据库连接中执行一次采样.
+	Sample(db *sql.DB, ver int) error
+}
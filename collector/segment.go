@@ -72,7 +72,7 @@ func scrapeSegmentConfig(db *sql.DB, ch chan<- prometheus.Metric, ver int) error
 	defer cancel()
 
 	querySql := segmentConfigSql_V6
-	if ver < 6 {
+	if ver < verGP6 {
 		querySql = segmentConfigSql_V5
 	}
 
@@ -87,6 +87,7 @@ func scrapeSegmentConfig(db *sql.DB, ch chan<- prometheus.Metric, ver int) error
 
 	errs := make([]error, 0)
 
+	segments := make([]segmentHealth, 0)
 	for rows.Next() {
 		var dbID, content, role, preferredRole, mode, status, hostname, address, port string
 		var rp sql.NullString
@@ -101,6 +102,12 @@ func scrapeSegmentConfig(db *sql.DB, ch chan<- prometheus.Metric, ver int) error
 		ch <- prometheus.MustNewConstMetric(statusDesc, prometheus.GaugeValue, getStatus(status), hostname, address, dbID, content, preferredRole, port, rp.String)
 		ch <- prometheus.MustNewConstMetric(roleDesc, prometheus.GaugeValue, getRole(role), hostname, address, dbID, content, preferredRole, port, rp.String)
 		ch <- prometheus.MustNewConstMetric(modeDesc, prometheus.GaugeValue, getMode(mode), hostname, address, dbID, content, preferredRole, port, rp.String)
+
+		segments = append(segments, segmentHealth{dbID, content, hostname, role, preferredRole, mode, status})
+	}
+
+	if len(errs) == 0 && rows.Err() == nil {
+		clusterHealth.setSegments(segments)
 	}
 
 	return combineErr(errs...)
@@ -0,0 +1,178 @@
+package collector
+
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+	logger "github.com/prometheus/common/log"
+)
+
+/**
+ *  Segment连接饱和度抓取器
+ *  会话派生gang时，segment上的连接槽位往往比master更早耗尽；
+ *  统计每个primary segment上的后端进程数、max_connections与使用率，以及QE进程数最多的若干个会话
+ */
+
+const (
+	segmentConnectionsSql = `
+		SELECT c.content, c.hostname, coalesce(a.backends,0), m.paramvalue::float8
+		  FROM gp_segment_configuration c
+		  LEFT JOIN (
+			SELECT gp_execution_segment() segid, count(*) backends
+			  FROM gp_dist_random('pg_stat_activity')
+			GROUP BY 1
+		  ) a ON a.segid=c.content
+		  LEFT JOIN gp_toolkit.gp_param_setting('max_connections') m ON m.paramsegment=c.content
+		WHERE c.role='p'
+		AND c.content >= 0
+		`
+	segmentConnectionsSql_V7 = `
+		SELECT c.content, c.hostname, coalesce(a.backends,0), m.paramvalue::float8
+		  FROM gp_segment_configuration c
+		  LEFT JOIN (
+			SELECT gp_execution_segment() segid, count(*) backends
+			  FROM gp_dist_random('pg_stat_activity')
+			WHERE backend_type='client backend'
+			GROUP BY 1
+		  ) a ON a.segid=c.content
+		  LEFT JOIN gp_toolkit.gp_param_setting('max_connections') m ON m.paramsegment=c.content
+		WHERE c.role='p'
+		AND c.content >= 0
+		`
+	sessionQeProcessesSql = `
+		SELECT q.sess_id::text, coalesce(s.usename,''), coalesce(s.datname,''), q.qe_count
+		  FROM (
+			SELECT sess_id, count(*) qe_count
+			  FROM gp_dist_random('pg_stat_activity')
+			WHERE sess_id > 0
+			GROUP BY 1
+			ORDER BY 2 DESC
+			LIMIT $1
+		  ) q
+		  LEFT JOIN (
+			SELECT DISTINCT sess_id, usename, datname
+			  FROM pg_stat_activity
+		  ) s ON s.sess_id=q.sess_id
+		`
+)
+
+var (
+	segmentBackendsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemNode, "segment_backends"),
+		"Number of backend processes on each primary segment",
+		[]string{"hostname", "content"}, nil,
+	)
+
+	segmentMaxConnDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemNode, "segment_max_connections"),
+		"Value of max_connections on each primary segment",
+		[]string{"hostname", "content"}, nil,
+	)
+
+	segmentConnUtilizationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemNode, "segment_connections_utilization_ratio"),
+		"Ratio of backend processes to max_connections on each primary segment",
+		[]string{"hostname", "content"}, nil,
+	)
+
+	sessionQeProcessesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemCluster, "session_qe_processes"),
+		"Number of QE processes across all segments of the sessions with the most QE processes",
+		[]string{"sess_id", "usename", "dbname"}, nil,
+	)
+)
+
+func NewSegmentConnectionsScraper(topN int) Scraper {
+	return segmentConnectionsScraper{topN: topN}
+}
+
+type segmentConnectionsScraper struct {
+	topN int
+}
+
+func (segmentConnectionsScraper) Name() string {
+	return "segment_connections_scraper"
+}
+
+func (segmentConnectionsScraper) Requirements(ver int) Requirements {
+	return Requirements{Relations: []string{"pg_catalog.pg_stat_activity"}, Functions: []string{"gp_toolkit.gp_param_setting", "pg_catalog.gp_execution_segment"}}
+}
+
+func (s segmentConnectionsScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
+	errC := scrapeSegmentConnections(db, ch, ver)
+	errQ := scrapeSessionQeProcesses(db, s.topN, ch)
+
+	return combineErr(errC, errQ)
+}
+
+func scrapeSegmentConnections(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
+	// Greenplum 7起pg_stat_activity包含后台进程，只统计占用连接槽位的客户端后端进程
+	querySql := segmentConnectionsSql
+	if ver >= verGP7 {
+		querySql = segmentConnectionsSql_V7
+	}
+
+	rows, err := db.Query(querySql)
+	logger.Infof("Query Database: %s", querySql)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	errs := make([]error, 0)
+
+	for rows.Next() {
+		var content, hostname string
+		var backends float64
+		var maxConn sql.NullFloat64
+
+		err = rows.Scan(&content, &hostname, &backends, &maxConn)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(segmentBackendsDesc, prometheus.GaugeValue, backends, hostname, content)
+
+		if maxConn.Valid && maxConn.Float64 > 0 {
+			ch <- prometheus.MustNewConstMetric(segmentMaxConnDesc, prometheus.GaugeValue, maxConn.Float64, hostname, content)
+			ch <- prometheus.MustNewConstMetric(segmentConnUtilizationDesc, prometheus.GaugeValue, backends/maxConn.Float64, hostname, content)
+		}
+	}
+
+	return combineErr(errs...)
+}
+
+func scrapeSessionQeProcesses(db *sql.DB, topN int, ch chan<- prometheus.Metric) error {
+	if topN <= 0 {
+		return nil
+	}
+
+	rows, err := db.Query(sessionQeProcessesSql, topN)
+	logger.Infof("Query Database: %s", sessionQeProcessesSql)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	errs := make([]error, 0)
+
+	for rows.Next() {
+		var sessID, usename, dbname string
+		var count float64
+
+		err = rows.Scan(&sessID, &usename, &dbname, &count)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(sessionQeProcessesDesc, prometheus.GaugeValue, count, sessID, usename, dbname)
+	}
+
+	return combineErr(errs...)
+}
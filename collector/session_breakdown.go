@@ -0,0 +1,179 @@
+package collector
+
+import (
+	"database/sql"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	logger "github.com/prometheus/common/log"
+)
+
+/**
+ *  会话分布抓取器
+ *  按数据库、应用名、会话状态与等待原因统计pg_stat_activity中的会话数，
+ *  会话数最多的若干个应用名保留原值，其余应用名合并为other，以限制时间序列数量；
+ *  Greenplum 7起pg_stat_activity不再提供waiting_reason，等待原因取活动会话的wait_event_type
+ */
+
+const (
+	sessionBreakdownSql_V6 = `
+		SELECT coalesce(datname,''), coalesce(application_name,''), coalesce(state,'')
+			 , CASE WHEN waiting THEN coalesce(waiting_reason,'') ELSE '' END
+			 , count(*)
+		  FROM pg_stat_activity
+		WHERE pid <> pg_backend_pid()
+		GROUP BY 1,2,3,4
+		`
+	sessionBreakdownSql_V7 = `
+		SELECT coalesce(datname,''), coalesce(application_name,''), coalesce(state,'')
+			 , CASE WHEN state='active' THEN lower(coalesce(wait_event_type,'')) ELSE '' END
+			 , count(*)
+		  FROM pg_stat_activity
+		WHERE pid <> pg_backend_pid()
+		AND backend_type='client backend'
+		GROUP BY 1,2,3,4
+		`
+	sessionBreakdownSql_V5 = `
+		SELECT coalesce(datname,''), coalesce(application_name,'')
+			 , CASE WHEN current_query='<IDLE>' THEN 'idle'
+					WHEN current_query='<IDLE> in transaction' THEN 'idle in transaction'
+					WHEN current_query='<IDLE> in transaction (aborted)' THEN 'idle in transaction (aborted)'
+					WHEN current_query='<FASTPATH> function call' THEN 'fastpath function call'
+					WHEN current_query='<insufficient privilege>' THEN ''
+					ELSE 'active' END
+			 , CASE WHEN waiting THEN 'lock' ELSE '' END
+			 , count(*)
+		  FROM pg_stat_activity
+		WHERE procpid <> pg_backend_pid()
+		GROUP BY 1,2,3,4
+		`
+)
+
+const otherApplicationName = "other"
+
+var (
+	sessionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemCluster, "sessions"),
+		"Number of sessions by database, application, state and waiting reason, applications beyond the cap are merged into other",
+		[]string{"dbname", "application_name", "state", "waiting_reason"}, nil,
+	)
+
+	sessionApplicationsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemCluster, "session_applications"),
+		"Number of distinct application names of current sessions before the cap is applied",
+		nil, nil,
+	)
+)
+
+type sessionGroup struct {
+	dbname, application, state, waitingReason string
+}
+
+func NewSessionBreakdownScraper(maxApplications int) Scraper {
+	return sessionBreakdownScraper{maxApplications: maxApplications}
+}
+
+type sessionBreakdownScraper struct {
+	maxApplications int
+}
+
+func (sessionBreakdownScraper) Name() string {
+	return "session_breakdown_scraper"
+}
+
+func (sessionBreakdownScraper) Requirements(ver int) Requirements {
+	return Requirements{AllStats: true}
+}
+
+func (s sessionBreakdownScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
+	querySql := sessionBreakdownSql_V6
+	if ver >= verGP7 {
+		querySql = sessionBreakdownSql_V7
+	} else if ver < verGP6 {
+		querySql = sessionBreakdownSql_V5
+	}
+
+	rows, err := db.Query(querySql)
+	logger.Infof("Query Database: %s", querySql)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	errs := make([]error, 0)
+
+	counts := make(map[sessionGroup]float64)
+	appTotals := make(map[string]float64)
+	for rows.Next() {
+		var group sessionGroup
+		var count float64
+
+		err = rows.Scan(&group.dbname, &group.application, &group.state, &group.waitingReason, &count)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		counts[group] += count
+		appTotals[group.application] += count
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	kept := topApplications(appTotals, s.maxApplications)
+
+	merged := make(map[sessionGroup]float64)
+	for group, count := range counts {
+		if !kept[group.application] {
+			group.application = otherApplicationName
+		}
+
+		merged[group] += count
+	}
+
+	for group, count := range merged {
+		ch <- prometheus.MustNewConstMetric(sessionsDesc, prometheus.GaugeValue, count, group.dbname, group.application, group.state, group.waitingReason)
+	}
+
+	ch <- prometheus.MustNewConstMetric(sessionApplicationsDesc, prometheus.GaugeValue, float64(len(appTotals)))
+
+	return combineErr(errs...)
+}
+
+/**
+* 函数：topApplications
+* 功能：按会话数从多到少取前max个应用名，会话数相同时按名称排序以保证结果稳定
+ */
+func topApplications(appTotals map[string]float64, max int) map[string]bool {
+	apps := make([]string, 0, len(appTotals))
+	for app := range appTotals {
+		apps = append(apps, app)
+	}
+
+	sort.Slice(apps, func(i, j int) bool {
+		if appTotals[apps[i]] != appTotals[apps[j]] {
+			return appTotals[apps[i]] > appTotals[apps[j]]
+		}
+
+		return apps[i] < apps[j]
+	})
+
+	if max < 0 {
+		max = 0
+	}
+
+	if len(apps) > max {
+		apps = apps[:max]
+	}
+
+	kept := make(map[string]bool, len(apps))
+	for _, app := range apps {
+		kept[app] = true
+	}
+
+	return kept
+}
@@ -0,0 +1,31 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTopApplications(t *testing.T) {
+	totals := map[string]float64{"psql": 3, "etl": 10, "bi": 3, "": 1}
+
+	tests := []struct {
+		max  int
+		kept map[string]bool
+	}{
+		{max: 2, kept: map[string]bool{"etl": true, "bi": true}},
+		{max: 3, kept: map[string]bool{"etl": true, "bi": true, "psql": true}},
+		{max: 10, kept: map[string]bool{"etl": true, "bi": true, "psql": true, "": true}},
+		{max: 0, kept: map[string]bool{}},
+		{max: -1, kept: map[string]bool{}},
+	}
+
+	for _, test := range tests {
+		if kept := topApplications(totals, test.max); !reflect.DeepEqual(kept, test.kept) {
+			t.Errorf("topApplications(max=%d) = %v, want %v", test.max, kept, test.kept)
+		}
+	}
+
+	if kept := topApplications(map[string]float64{}, 5); len(kept) != 0 {
+		t.Errorf("topApplications of no sessions = %v, want empty", kept)
+	}
+}
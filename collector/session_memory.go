@@ -0,0 +1,179 @@
+package collector
+
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+	logger "github.com/prometheus/common/log"
+)
+
+/**
+ *  会话内存抓取器
+ *  基于session_state.session_level_memory_consumption统计每个primary segment已使用的vmem、
+ *  gp_vmem_protect_limit上限、空闲会话占用的vmem、runaway会话数量，以及占用内存最多的若干个会话
+ */
+
+const (
+	segmentVmemSql = `
+		SELECT c.content
+			 , c.hostname
+			 , coalesce(m.vmem_mb,0)
+			 , coalesce(m.idle_vmem_mb,0)
+			 , coalesce(m.runaway,0)
+			 , p.paramvalue::float8
+		  FROM gp_segment_configuration c
+		  LEFT JOIN (
+			SELECT segid
+				 , sum(vmem_mb) vmem_mb
+				 , sum(CASE WHEN active_qe_count=0 THEN vmem_mb ELSE 0 END) idle_vmem_mb
+				 , sum(CASE WHEN is_runaway THEN 1 ELSE 0 END) runaway
+			  FROM session_state.session_level_memory_consumption
+			GROUP BY segid
+		  ) m ON m.segid=c.content
+		  LEFT JOIN gp_toolkit.gp_param_setting('gp_vmem_protect_limit') p ON p.paramsegment=c.content
+		WHERE c.role='p'
+		AND c.content >= 0
+		`
+	topSessionVmemSql = `
+		SELECT sess_id::text, coalesce(datname,''), coalesce(usename,''), sum(vmem_mb), bool_or(is_runaway)
+		  FROM session_state.session_level_memory_consumption
+		GROUP BY 1,2,3
+		ORDER BY 4 DESC
+		LIMIT $1
+		`
+)
+
+var (
+	segmentVmemUsedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemNode, "segment_vmem_used_mb"),
+		"Vmem in MB used by all sessions on each primary segment",
+		[]string{"hostname", "content"}, nil,
+	)
+
+	segmentVmemLimitDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemNode, "segment_vmem_protect_limit_mb"),
+		"Value of gp_vmem_protect_limit in MB on each primary segment",
+		[]string{"hostname", "content"}, nil,
+	)
+
+	segmentIdleVmemDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemNode, "segment_idle_session_vmem_mb"),
+		"Vmem in MB held by sessions without active query processes on each primary segment",
+		[]string{"hostname", "content"}, nil,
+	)
+
+	segmentRunawayDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemNode, "segment_runaway_sessions"),
+		"Number of sessions marked as runaway by the runaway detector on each primary segment",
+		[]string{"hostname", "content"}, nil,
+	)
+
+	sessionVmemDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemCluster, "session_vmem_mb"),
+		"Vmem in MB used across all segments by the sessions using the most memory",
+		[]string{"sess_id", "dbname", "usename"}, nil,
+	)
+
+	sessionRunawayDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemCluster, "session_runaway"),
+		"Whether the session using the most memory is marked as runaway on any segment",
+		[]string{"sess_id", "dbname", "usename"}, nil,
+	)
+)
+
+func NewSessionMemoryScraper(topN int) Scraper {
+	return sessionMemoryScraper{topN: topN}
+}
+
+type sessionMemoryScraper struct {
+	topN int
+}
+
+func (sessionMemoryScraper) Name() string {
+	return "session_memory_scraper"
+}
+
+func (sessionMemoryScraper) Requirements(ver int) Requirements {
+	return Requirements{Relations: []string{"session_state.session_level_memory_consumption"}, Functions: []string{"gp_toolkit.gp_param_setting"}}
+}
+
+func (s sessionMemoryScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
+	errS := scrapeSegmentVmem(db, ch)
+	errT := scrapeTopSessionVmem(db, s.topN, ch)
+
+	return combineErr(errS, errT)
+}
+
+func scrapeSegmentVmem(db *sql.DB, ch chan<- prometheus.Metric) error {
+	rows, err := db.Query(segmentVmemSql)
+	logger.Infof("Query Database: %s", segmentVmemSql)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	errs := make([]error, 0)
+
+	for rows.Next() {
+		var content, hostname string
+		var used, idle, runaway float64
+		var limit sql.NullFloat64
+
+		err = rows.Scan(&content, &hostname, &used, &idle, &runaway, &limit)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(segmentVmemUsedDesc, prometheus.GaugeValue, used, hostname, content)
+		ch <- prometheus.MustNewConstMetric(segmentIdleVmemDesc, prometheus.GaugeValue, idle, hostname, content)
+		ch <- prometheus.MustNewConstMetric(segmentRunawayDesc, prometheus.GaugeValue, runaway, hostname, content)
+
+		if limit.Valid {
+			ch <- prometheus.MustNewConstMetric(segmentVmemLimitDesc, prometheus.GaugeValue, limit.Float64, hostname, content)
+		}
+	}
+
+	return combineErr(errs...)
+}
+
+func scrapeTopSessionVmem(db *sql.DB, topN int, ch chan<- prometheus.Metric) error {
+	if topN <= 0 {
+		return nil
+	}
+
+	rows, err := db.Query(topSessionVmemSql, topN)
+	logger.Infof("Query Database: %s", topSessionVmemSql)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	errs := make([]error, 0)
+
+	for rows.Next() {
+		var sessID, dbname, usename string
+		var vmem float64
+		var runaway bool
+
+		err = rows.Scan(&sessID, &dbname, &usename, &vmem, &runaway)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		isRunaway := 0.0
+		if runaway {
+			isRunaway = 1
+		}
+
+		ch <- prometheus.MustNewConstMetric(sessionVmemDesc, prometheus.GaugeValue, vmem, sessID, dbname, usename)
+		ch <- prometheus.MustNewConstMetric(sessionRunawayDesc, prometheus.GaugeValue, isRunaway, sessID, dbname, usename)
+	}
+
+	return combineErr(errs...)
+}
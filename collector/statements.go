@@ -0,0 +1,201 @@
+package collector
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	logger "github.com/prometheus/common/log"
+)
+
+/**
+ *  SQL语句统计抓取器
+ *  读取pg_stat_statements扩展中按总耗时与按调用次数排名靠前的语句的调用次数、耗时、返回行数与共享块命中/读取数；
+ *  为避免时间序列频繁变化，已输出过的语句在跌出前2N名之前会持续输出，归一化的SQL文本单独通过info指标输出；
+ *  PostgreSQL 13起（如Cloudberry）total_time更名为total_exec_time
+ */
+
+const (
+	execTimeSupportSql = `SELECT count(*) from pg_attribute where attrelid='pg_stat_statements'::regclass and attname='total_exec_time'`
+	statementsSql      = `
+		SELECT s.queryid::text, d.datname, r.rolname
+			 , s.calls, s.%[1]s/1000, s.rows, s.shared_blks_hit, s.shared_blks_read
+			 , left(regexp_replace(s.query, '\s+', ' ', 'g'), $2)
+			 , s.rank_time, s.rank_calls
+		  FROM (
+			SELECT *
+				 , row_number() over (order by %[1]s desc) rank_time
+				 , row_number() over (order by calls desc) rank_calls
+			  FROM pg_stat_statements
+		  ) s
+		  JOIN pg_database d ON d.oid=s.dbid
+		  JOIN pg_roles r ON r.oid=s.userid
+		WHERE s.rank_time <= $1 * 2
+		OR s.rank_calls <= $1 * 2
+		`
+)
+
+var (
+	statementCallsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemCluster, "statement_calls_total"),
+		"Number of times the statement was executed",
+		[]string{"queryid", "dbname", "usename"}, nil,
+	)
+
+	statementSecondsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemCluster, "statement_seconds_total"),
+		"Total time spent executing the statement",
+		[]string{"queryid", "dbname", "usename"}, nil,
+	)
+
+	statementMeanSecondsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemCluster, "statement_mean_seconds"),
+		"Mean time spent executing the statement",
+		[]string{"queryid", "dbname", "usename"}, nil,
+	)
+
+	statementRowsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemCluster, "statement_rows_total"),
+		"Total number of rows retrieved or affected by the statement",
+		[]string{"queryid", "dbname", "usename"}, nil,
+	)
+
+	statementBlksHitDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemCluster, "statement_shared_blks_hit_total"),
+		"Total number of shared block cache hits by the statement",
+		[]string{"queryid", "dbname", "usename"}, nil,
+	)
+
+	statementBlksReadDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemCluster, "statement_shared_blks_read_total"),
+		"Total number of shared blocks read by the statement",
+		[]string{"queryid", "dbname", "usename"}, nil,
+	)
+
+	statementInfoDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemCluster, "statement_info"),
+		"Truncated normalized query text of the statement, value is always 1",
+		[]string{"queryid", "dbname", "usename", "query"}, nil,
+	)
+)
+
+type statementKey struct {
+	queryid, dbname, usename string
+}
+
+func NewStatementsScraper(topN, queryLength int) Scraper {
+	return &statementsScraper{
+		topN:        topN,
+		queryLength: queryLength,
+		tracked:     make(map[statementKey]bool),
+	}
+}
+
+type statementsScraper struct {
+	topN        int
+	queryLength int
+
+	mu      sync.Mutex
+	tracked map[statementKey]bool
+}
+
+func (*statementsScraper) Name() string {
+	return "statements_scraper"
+}
+
+func (*statementsScraper) Requirements(ver int) Requirements {
+	// 扩展可能安装在任意模式中，视图名不带模式名，按search_path查找
+	return Requirements{MinVersion: verGP6, Extensions: []string{"pg_stat_statements"}, Relations: []string{"pg_stat_statements"}, AllStats: true}
+}
+
+func (s *statementsScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
+	execTime, err := execTimeSupported(db)
+	if err != nil {
+		return err
+	}
+
+	timeColumn := "total_time"
+	if execTime {
+		timeColumn = "total_exec_time"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	querySql := fmt.Sprintf(statementsSql, timeColumn)
+	rows, err := db.Query(querySql, s.topN, s.queryLength)
+	logger.Infof("Query Database: %s", querySql)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	errs := make([]error, 0)
+
+	tracked := make(map[statementKey]bool)
+	for rows.Next() {
+		var key statementKey
+		var calls, seconds, affected, blksHit, blksRead float64
+		var query string
+		var rankTime, rankCalls int
+
+		err = rows.Scan(&key.queryid, &key.dbname, &key.usename, &calls, &seconds, &affected, &blksHit, &blksRead, &query, &rankTime, &rankCalls)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		// 进入前N名时开始输出，已输出的语句跌出前2N名后才停止输出
+		if rankTime > s.topN && rankCalls > s.topN && !s.tracked[key] {
+			continue
+		}
+
+		tracked[key] = true
+
+		ch <- prometheus.MustNewConstMetric(statementCallsDesc, prometheus.CounterValue, calls, key.queryid, key.dbname, key.usename)
+		ch <- prometheus.MustNewConstMetric(statementSecondsDesc, prometheus.CounterValue, seconds, key.queryid, key.dbname, key.usename)
+		ch <- prometheus.MustNewConstMetric(statementRowsDesc, prometheus.CounterValue, affected, key.queryid, key.dbname, key.usename)
+		ch <- prometheus.MustNewConstMetric(statementBlksHitDesc, prometheus.CounterValue, blksHit, key.queryid, key.dbname, key.usename)
+		ch <- prometheus.MustNewConstMetric(statementBlksReadDesc, prometheus.CounterValue, blksRead, key.queryid, key.dbname, key.usename)
+		ch <- prometheus.MustNewConstMetric(statementInfoDesc, prometheus.GaugeValue, 1, key.queryid, key.dbname, key.usename, queryLabel(query, s.queryLength))
+
+		if calls > 0 {
+			ch <- prometheus.MustNewConstMetric(statementMeanSecondsDesc, prometheus.GaugeValue, seconds/calls, key.queryid, key.dbname, key.usename)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	s.tracked = tracked
+
+	return combineErr(errs...)
+}
+
+/**
+* 函数：execTimeSupported
+* 功能：检查pg_stat_statements是否包含total_exec_time列
+ */
+func execTimeSupported(db *sql.DB) (bool, error) {
+	rows, err := db.Query(execTimeSupportSql)
+	logger.Infof("Query Database: %s", execTimeSupportSql)
+
+	if err != nil {
+		return false, err
+	}
+
+	defer rows.Close()
+
+	var count int
+	for rows.Next() {
+		if err = rows.Scan(&count); err != nil {
+			return false, err
+		}
+	}
+
+	return count > 0, rows.Err()
+}
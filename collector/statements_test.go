@@ -0,0 +1,40 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestQueryLabel(t *testing.T) {
+	tests := []struct {
+		text   string
+		length int
+		want   string
+	}{
+		{text: "select 1", length: 100, want: "select 1"},
+		{text: "select 'caf\xe9' from t", length: 100, want: "select 'caf?' from t"},
+		{text: "select \xff\xfe from t", length: 100, want: "select ? from t"},
+		{text: "select '中文' from 表", length: 11, want: "select '中文'"},
+		// SQL_ASCII数据库中left()按字节截断，可能截断在多字节字符中间
+		{text: "select '中\xe6\x96", length: 100, want: "select '中?"},
+		{text: strings.Repeat("表", 20), length: 5, want: strings.Repeat("表", 5)},
+		{text: "", length: 5, want: ""},
+	}
+
+	for _, test := range tests {
+		got := queryLabel(test.text, test.length)
+		if got != test.want {
+			t.Errorf("queryLabel(%q, %d) = %q, want %q", test.text, test.length, got, test.want)
+		}
+
+		if !utf8.ValidString(got) {
+			t.Errorf("queryLabel(%q, %d) = %q is not valid UTF-8", test.text, test.length, got)
+		}
+
+		// 标签值不是合法的UTF-8时会panic
+		prometheus.MustNewConstMetric(statementInfoDesc, prometheus.GaugeValue, 1, "1", "db", "user", got)
+	}
+}
@@ -0,0 +1,159 @@
+package collector
+
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+	logger "github.com/prometheus/common/log"
+)
+
+/**
+ *  优化器统计信息缺失抓取器
+ *  基于gp_toolkit.gp_stats_missing按数据库统计没有统计信息、缺少列统计信息的表数量，
+ *  在pg_stat_user_tables提供n_mod_since_analyze列时，输出自上次ANALYZE以来修改行数最多的若干张表
+ */
+
+const (
+	statsMissingSql = `
+		SELECT sum(CASE WHEN NOT smisize THEN 1 ELSE 0 END)
+			 , sum(CASE WHEN smirecs < smicols THEN 1 ELSE 0 END)
+		  FROM gp_toolkit.gp_stats_missing
+		`
+	modSinceAnalyzeSupportSql = `SELECT count(*) from pg_attribute where attrelid='pg_catalog.pg_stat_user_tables'::regclass and attname='n_mod_since_analyze'`
+	modSinceAnalyzeSql        = `
+		SELECT schemaname, relname, n_mod_since_analyze
+		  FROM pg_stat_user_tables
+		WHERE n_mod_since_analyze > 0
+		ORDER BY n_mod_since_analyze DESC
+		LIMIT $1
+		`
+)
+
+var (
+	tablesMissingStatsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemServer, "database_tables_missing_stats"),
+		"Number of tables without row count and row size statistics in each database",
+		[]string{"dbname"},
+		nil,
+	)
+
+	tablesMissingColumnStatsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemServer, "database_tables_missing_column_stats"),
+		"Number of tables with one or more columns lacking statistics in each database",
+		[]string{"dbname"},
+		nil,
+	)
+
+	modSinceAnalyzeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemServer, "database_table_mod_since_analyze"),
+		"Rows modified since the last analyze of the most modified tables in each database",
+		[]string{"dbname", "schema", "table"},
+		nil,
+	)
+)
+
+func NewStatsMissingScraper(topN int) Scraper {
+	return statsMissingScraper{topN: topN}
+}
+
+type statsMissingScraper struct {
+	topN int
+}
+
+func (statsMissingScraper) Name() string {
+	return "stats_missing_scraper"
+}
+
+func (statsMissingScraper) Requirements(ver int) Requirements {
+	return Requirements{Relations: []string{"gp_toolkit.gp_stats_missing"}}
+}
+
+func (s statsMissingScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
+	return scrapeEachDatabase(db, func(dbname string, conn *sql.DB) error {
+		errS := scrapeStatsMissing(conn, dbname, ch)
+		errM := scrapeModSinceAnalyze(conn, dbname, s.topN, ch)
+
+		return combineErr(errS, errM)
+	})
+}
+
+func scrapeStatsMissing(conn *sql.DB, dbname string, ch chan<- prometheus.Metric) error {
+	rows, err := conn.Query(statsMissingSql)
+	logger.Infof("Query Database: %s", statsMissingSql)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var noStats, noColumnStats sql.NullFloat64
+
+		if err = rows.Scan(&noStats, &noColumnStats); err != nil {
+			return err
+		}
+
+		ch <- prometheus.MustNewConstMetric(tablesMissingStatsDesc, prometheus.GaugeValue, noStats.Float64, dbname)
+		ch <- prometheus.MustNewConstMetric(tablesMissingColumnStatsDesc, prometheus.GaugeValue, noColumnStats.Float64, dbname)
+	}
+
+	return rows.Err()
+}
+
+func scrapeModSinceAnalyze(conn *sql.DB, dbname string, topN int, ch chan<- prometheus.Metric) error {
+	if topN <= 0 {
+		return nil
+	}
+
+	supported, err := modSinceAnalyzeSupported(conn)
+	if err != nil || !supported {
+		return err
+	}
+
+	rows, err := conn.Query(modSinceAnalyzeSql, topN)
+	logger.Infof("Query Database: %s", modSinceAnalyzeSql)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	errs := make([]error, 0)
+
+	for rows.Next() {
+		var schema, table string
+		var modified float64
+
+		err = rows.Scan(&schema, &table, &modified)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(modSinceAnalyzeDesc, prometheus.GaugeValue, modified, dbname, schema, table)
+	}
+
+	return combineErr(errs...)
+}
+
+func modSinceAnalyzeSupported(conn *sql.DB) (bool, error) {
+	rows, err := conn.Query(modSinceAnalyzeSupportSql)
+	logger.Infof("Query Database: %s", modSinceAnalyzeSupportSql)
+
+	if err != nil {
+		return false, err
+	}
+
+	defer rows.Close()
+
+	var count int
+	for rows.Next() {
+		if err = rows.Scan(&count); err != nil {
+			return false, err
+		}
+	}
+
+	return count > 0, rows.Err()
+}
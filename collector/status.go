@@ -0,0 +1,91 @@
+package collector
+
+import (
+	"sort"
+	"time"
+)
+
+/**
+ *  采集器状态
+ *  记录最近一次成功检查数据库连接的时间与各抓取器最近一次抓取的结果，
+ *  供健康检查与首页展示使用，读取状态不会访问数据库
+ */
+
+type ScraperStatus struct {
+	Name       string
+	LastScrape time.Time
+	Duration   time.Duration
+	Error      string
+	Disabled   string
+}
+
+/**
+* 函数：CheckConnection
+* 功能：检查数据库连接，供后台定期检查使用，使抓取间隔较长时仍能及时反映连接状态
+ */
+func (c *GreenPlumCollector) CheckConnection() error {
+	_, _, _, err := c.connection()
+	return err
+}
+
+/**
+* 函数：LastConnected
+* 功能：返回最近一次成功检查数据库连接的时间，从未成功时返回零值
+ */
+func (c *GreenPlumCollector) LastConnected() time.Time {
+	c.statusMu.RLock()
+	defer c.statusMu.RUnlock()
+
+	return c.lastConnected
+}
+
+/**
+* 函数：ScraperStatuses
+* 功能：按名称顺序返回所有启用的抓取器最近一次抓取的结果，尚未抓取过的抓取器LastScrape为零值
+ */
+func (c *GreenPlumCollector) ScraperStatuses() []ScraperStatus {
+	c.statusMu.RLock()
+	defer c.statusMu.RUnlock()
+
+	statuses := make([]ScraperStatus, 0, len(c.scrapers))
+	for _, scraper := range c.scrapers {
+		status, ok := c.statuses[scraper.Name()]
+		if !ok {
+			status = ScraperStatus{Name: scraper.Name()}
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+
+	return statuses
+}
+
+func (c *GreenPlumCollector) setConnected() {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+
+	c.lastConnected = time.Now()
+}
+
+func (c *GreenPlumCollector) setScraperDisabled(name string, reason string) {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+
+	c.statuses[name] = ScraperStatus{Name: name, Disabled: reason}
+}
+
+func (c *GreenPlumCollector) setScraperStatus(name string, start time.Time, err error) {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+
+	status := ScraperStatus{Name: name, LastScrape: start, Duration: time.Since(start)}
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	c.statuses[name] = status
+}
@@ -11,7 +11,6 @@ import (
  */
 
 const (
-	//?????????????????????????????????????
 	systemMetricsSql = `select * from system_now;`
 )
 
@@ -159,7 +158,28 @@ func (systemScraper) Name() string {
 	return "systemScraper"
 }
 
+func (systemScraper) Requirements(ver int) Requirements {
+	return Requirements{MaxVersion: verGP6, GpperfmonRelations: []string{"public.system_now"}}
+}
+
 func (systemScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
+	perfmonDB, err := gpperfmon.connect(db)
+	if err != nil {
+		return err
+	}
+
+	if perfmonDB == nil {
+		logger.Warn("gpperfmon is not installed, skip scraping system_now")
+		return nil
+	}
+
+	errA := scrapeGpperfmonDataAge(perfmonDB, "system_now", ch)
+	errS := scrapeSystemNow(perfmonDB, ch)
+
+	return combineErr(errS, errA)
+}
+
+func scrapeSystemNow(db *sql.DB, ch chan<- prometheus.Metric) error {
 	rows, err := db.Query(systemMetricsSql)
 	logger.Infof("Query Database: %s",systemMetricsSql)
 
@@ -0,0 +1,70 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+/**
+ *  数据库产品与版本识别
+ *  从version()中识别Greenplum 5/6/7与Apache Cloudberry，抓取器按兼容级别选择SQL：
+ *  Greenplum的兼容级别为其主版本号；Cloudberry基于Greenplum 7演进而来，系统表与Greenplum 7一致，兼容级别为7
+ */
+
+const (
+	flavorGreenplum  = "greenplum"
+	flavorCloudberry = "cloudberry"
+)
+
+// 兼容级别，作为ver参数传递给抓取器
+const (
+	verGP5 = 5
+	verGP6 = 6
+	verGP7 = 7
+)
+
+const serverVersionSql = `select version()`
+
+var (
+	productVersionRegexp  = regexp.MustCompile(`(Greenplum Database|Cloudberry Database|Apache Cloudberry) (\d+)\.(\d+)\.(\d+)`)
+	postgresVersionRegexp = regexp.MustCompile(`PostgreSQL (\d+(?:\.\d+)*)`)
+)
+
+type serverVersion struct {
+	flavor   string
+	version  string
+	postgres string
+	compat   int
+}
+
+/**
+* 函数：parseServerVersion
+* 功能：解析version()的输出，得到产品、产品版本、PostgreSQL内核版本与兼容级别
+ */
+func parseServerVersion(s string) (serverVersion, error) {
+	m := productVersionRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return serverVersion{}, fmt.Errorf("unsupported database: %s", s)
+	}
+
+	v := serverVersion{version: m[2] + "." + m[3] + "." + m[4]}
+	if pg := postgresVersionRegexp.FindStringSubmatch(s); pg != nil {
+		v.postgres = pg[1]
+	}
+
+	if m[1] == "Greenplum Database" {
+		major, _ := strconv.Atoi(m[2])
+		if major < verGP5 {
+			return serverVersion{}, fmt.Errorf("unsupported greenplum version: %s", v.version)
+		}
+
+		v.flavor = flavorGreenplum
+		v.compat = major
+	} else {
+		v.flavor = flavorCloudberry
+		v.compat = verGP7
+	}
+
+	return v, nil
+}
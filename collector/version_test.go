@@ -0,0 +1,63 @@
+package collector
+
+import "testing"
+
+func TestParseServerVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		want    serverVersion
+		err     bool
+	}{
+		{
+			name:    "greenplum 5",
+			version: "PostgreSQL 8.3.23 (Greenplum Database 5.28.4 build commit:8b4d2ea5c0b1c9c6d5e3c6b2b0d6f2b9a1e8f0d2) on x86_64-pc-linux-gnu, compiled by GCC gcc (GCC) 6.4.0, 64-bit compiled on Jan 12 2021 22:17:48",
+			want:    serverVersion{flavor: flavorGreenplum, version: "5.28.4", postgres: "8.3.23", compat: verGP5},
+		},
+		{
+			name:    "greenplum 6",
+			version: "PostgreSQL 9.4.26 (Greenplum Database 6.25.3 build commit:367edc6b4dfd909fe38fc288ade9e294d74e3f9a Open Source) on x86_64-pc-linux-gnu, compiled by gcc (GCC) 6.4.0, 64-bit compiled on Oct  4 2023 23:27:39",
+			want:    serverVersion{flavor: flavorGreenplum, version: "6.25.3", postgres: "9.4.26", compat: verGP6},
+		},
+		{
+			name:    "greenplum 7",
+			version: "PostgreSQL 12.12 (Greenplum Database 7.1.0 build commit:e7c2b1f14bb42a1018ac57d14f4436880e0a0515 Open Source) on x86_64-pc-linux-gnu, compiled by gcc (GCC) 8.5.0 20210514 (Red Hat 8.5.0-18), 64-bit compiled on Jan 19 2024 06:48:29 Bhuvnesh C.",
+			want:    serverVersion{flavor: flavorGreenplum, version: "7.1.0", postgres: "12.12", compat: verGP7},
+		},
+		{
+			name:    "cloudberry database",
+			version: "PostgreSQL 14.4 (Cloudberry Database 1.6.0 build 1) on x86_64-pc-linux-gnu, compiled by gcc (GCC) 10.2.1 20210130 (Red Hat 10.2.1-11), 64-bit compiled on Aug 15 2024 10:20:01",
+			want:    serverVersion{flavor: flavorCloudberry, version: "1.6.0", postgres: "14.4", compat: verGP7},
+		},
+		{
+			name:    "apache cloudberry",
+			version: "PostgreSQL 14.4 (Apache Cloudberry 2.0.0-incubating build 1) on x86_64-pc-linux-gnu, compiled by gcc (GCC) 11.4.1 20231218 (Red Hat 11.4.1-3), 64-bit compiled on Jun  3 2025 15:51:16",
+			want:    serverVersion{flavor: flavorCloudberry, version: "2.0.0", postgres: "14.4", compat: verGP7},
+		},
+		{
+			name:    "greenplum 4",
+			version: "PostgreSQL 8.2.15 (Greenplum Database 4.3.33.6 build 1) on x86_64-unknown-linux-gnu, compiled by GCC gcc (GCC) 4.4.2 compiled on Jun 26 2019 19:33:42",
+			err:     true,
+		},
+		{
+			name:    "postgresql",
+			version: "PostgreSQL 15.4 (Debian 15.4-1.pgdg120+1) on x86_64-pc-linux-gnu, compiled by gcc (Debian 12.2.0-14) 12.2.0, 64-bit",
+			err:     true,
+		},
+		{name: "empty", version: "", err: true},
+	}
+
+	for _, test := range tests {
+		got, err := parseServerVersion(test.version)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: parseServerVersion() = %+v, expected error", test.name, got)
+			}
+			continue
+		}
+
+		if err != nil || got != test.want {
+			t.Errorf("%s: parseServerVersion() = %+v, %v, want %+v", test.name, got, err, test.want)
+		}
+	}
+}
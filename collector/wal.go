@@ -0,0 +1,261 @@
+package collector
+
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+	logger "github.com/prometheus/common/log"
+)
+
+/**
+ *  WAL生成与归档抓取器
+ *  统计master及每个primary segment上已生成的WAL字节数、pg_stat_archiver中的归档成功/失败次数及最近时间，
+ *  以及在有权限读取时pg_xlog目录的大小；pg_stat_archiver与pg_xlog_location_diff自Greenplum 6起提供，
+ *  Greenplum 7起xlog相关函数与目录更名为wal
+ */
+
+const (
+	walBytesSql_V6 = `
+		SELECT c.content, c.hostname, w.bytes
+		  FROM gp_segment_configuration c
+		  JOIN (
+			SELECT -1 segid, pg_xlog_location_diff(pg_current_xlog_location(), '0/0') bytes
+			UNION ALL
+			SELECT gp_segment_id, pg_xlog_location_diff(pg_current_xlog_location(), '0/0')
+			  FROM gp_dist_random('gp_id')
+		  ) w ON w.segid=c.content
+		WHERE c.role='p'
+		`
+	archiverSql = `
+		SELECT c.content, c.hostname, a.archived_count, a.failed_count
+			 , extract(epoch from a.last_archived_time), extract(epoch from a.last_failed_time)
+		  FROM gp_segment_configuration c
+		  JOIN (
+			SELECT -1 segid, archived_count, failed_count, last_archived_time, last_failed_time
+			  FROM pg_stat_archiver
+			UNION ALL
+			SELECT gp_execution_segment(), archived_count, failed_count, last_archived_time, last_failed_time
+			  FROM gp_dist_random('pg_stat_archiver')
+		  ) a ON a.segid=c.content
+		WHERE c.role='p'
+		`
+	xlogDirSizeSql_V6 = `
+		SELECT c.content, c.hostname, x.size
+		  FROM gp_segment_configuration c
+		  JOIN (
+			SELECT -1 segid, sum((pg_stat_file('pg_xlog/' || f)).size) size
+			  FROM pg_ls_dir('pg_xlog') f
+			UNION ALL
+			SELECT segid, sum(size)
+			  FROM (
+				SELECT gp_segment_id segid, (pg_stat_file('pg_xlog/' || pg_ls_dir('pg_xlog'))).size
+				  FROM gp_dist_random('gp_id')
+			  ) s
+			GROUP BY segid
+		  ) x ON x.segid=c.content
+		WHERE c.role='p'
+		`
+	walBytesSql_V7 = `
+		SELECT c.content, c.hostname, w.bytes
+		  FROM gp_segment_configuration c
+		  JOIN (
+			SELECT -1 segid, pg_wal_lsn_diff(pg_current_wal_lsn(), '0/0') bytes
+			UNION ALL
+			SELECT gp_segment_id, pg_wal_lsn_diff(pg_current_wal_lsn(), '0/0')
+			  FROM gp_dist_random('gp_id')
+		  ) w ON w.segid=c.content
+		WHERE c.role='p'
+		`
+	xlogDirSizeSql_V7 = `
+		SELECT c.content, c.hostname, x.size
+		  FROM gp_segment_configuration c
+		  JOIN (
+			SELECT -1 segid, sum(size) size
+			  FROM pg_ls_waldir()
+			UNION ALL
+			SELECT segid, sum(size)
+			  FROM (
+				SELECT gp_segment_id segid, (pg_ls_waldir()).size
+				  FROM gp_dist_random('gp_id')
+			  ) s
+			GROUP BY segid
+		  ) x ON x.segid=c.content
+		WHERE c.role='p'
+		`
+)
+
+var (
+	walBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemNode, "segment_wal_bytes_total"),
+		"Bytes of WAL generated on master and each primary segment, derived from pg_current_xlog_location()",
+		[]string{"hostname", "content"}, nil,
+	)
+
+	walArchivedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemNode, "segment_wal_archived_total"),
+		"Number of WAL files successfully archived on master and each primary segment",
+		[]string{"hostname", "content"}, nil,
+	)
+
+	walArchiveFailedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemNode, "segment_wal_archive_failed_total"),
+		"Number of failed attempts to archive WAL files on master and each primary segment",
+		[]string{"hostname", "content"}, nil,
+	)
+
+	walLastArchivedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemNode, "segment_wal_last_archived_timestamp_seconds"),
+		"Time of the last successful WAL archive on master and each primary segment",
+		[]string{"hostname", "content"}, nil,
+	)
+
+	walLastFailedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemNode, "segment_wal_last_archive_failed_timestamp_seconds"),
+		"Time of the last failed WAL archive on master and each primary segment",
+		[]string{"hostname", "content"}, nil,
+	)
+
+	xlogDirSizeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subSystemNode, "segment_xlog_dir_bytes"),
+		"Size of the pg_xlog (pg_wal since greenplum 7) directory on master and each primary segment",
+		[]string{"hostname", "content"}, nil,
+	)
+)
+
+func NewWalScraper() Scraper {
+	return walScraper{}
+}
+
+type walScraper struct{}
+
+func (walScraper) Name() string {
+	return "wal_scraper"
+}
+
+func (walScraper) Requirements(ver int) Requirements {
+	// Greenplum 7起WAL位置函数改名，WAL目录大小改由pg_ls_waldir读取
+	functions := []string{"pg_catalog.gp_execution_segment", "pg_catalog.pg_xlog_location_diff", "pg_catalog.pg_current_xlog_location"}
+	optional := []string{"pg_catalog.pg_ls_dir", "pg_catalog.pg_stat_file"}
+	if ver >= verGP7 {
+		functions = []string{"pg_catalog.gp_execution_segment", "pg_catalog.pg_wal_lsn_diff", "pg_catalog.pg_current_wal_lsn"}
+		optional = []string{"pg_catalog.pg_ls_waldir"}
+	}
+
+	return Requirements{MinVersion: verGP6, Relations: []string{"pg_catalog.pg_stat_archiver"}, Functions: functions, OptionalFunctions: optional}
+}
+
+func (walScraper) Scrape(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
+	errW := scrapeWalBytes(db, ch, ver)
+	errA := scrapeArchiver(db, ch)
+
+	// pg_ls_dir、pg_stat_file与pg_ls_waldir默认需要超级用户权限，读取失败时仅记录日志
+	if err := scrapeXlogDirSize(db, ch, ver); err != nil {
+		logger.Warnf("get size of pg_xlog directory failed, error:%v", err)
+	}
+
+	return combineErr(errW, errA)
+}
+
+func scrapeWalBytes(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
+	querySql := walBytesSql_V6
+	if ver >= verGP7 {
+		querySql = walBytesSql_V7
+	}
+
+	rows, err := db.Query(querySql)
+	logger.Infof("Query Database: %s", querySql)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	errs := make([]error, 0)
+
+	for rows.Next() {
+		var content, hostname string
+		var bytes float64
+
+		err = rows.Scan(&content, &hostname, &bytes)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(walBytesDesc, prometheus.CounterValue, bytes, hostname, content)
+	}
+
+	return combineErr(errs...)
+}
+
+func scrapeArchiver(db *sql.DB, ch chan<- prometheus.Metric) error {
+	rows, err := db.Query(archiverSql)
+	logger.Infof("Query Database: %s", archiverSql)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	errs := make([]error, 0)
+
+	for rows.Next() {
+		var content, hostname string
+		var archived, failed float64
+		var lastArchived, lastFailed sql.NullFloat64
+
+		err = rows.Scan(&content, &hostname, &archived, &failed, &lastArchived, &lastFailed)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(walArchivedDesc, prometheus.CounterValue, archived, hostname, content)
+		ch <- prometheus.MustNewConstMetric(walArchiveFailedDesc, prometheus.CounterValue, failed, hostname, content)
+
+		if lastArchived.Valid {
+			ch <- prometheus.MustNewConstMetric(walLastArchivedDesc, prometheus.GaugeValue, lastArchived.Float64, hostname, content)
+		}
+
+		if lastFailed.Valid {
+			ch <- prometheus.MustNewConstMetric(walLastFailedDesc, prometheus.GaugeValue, lastFailed.Float64, hostname, content)
+		}
+	}
+
+	return combineErr(errs...)
+}
+
+func scrapeXlogDirSize(db *sql.DB, ch chan<- prometheus.Metric, ver int) error {
+	querySql := xlogDirSizeSql_V6
+	if ver >= verGP7 {
+		querySql = xlogDirSizeSql_V7
+	}
+
+	rows, err := db.Query(querySql)
+	logger.Infof("Query Database: %s", querySql)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	errs := make([]error, 0)
+
+	for rows.Next() {
+		var content, hostname string
+		var size float64
+
+		err = rows.Scan(&content, &hostname, &size)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(xlogDirSizeDesc, prometheus.GaugeValue, size, hostname, content)
+	}
+
+	return combineErr(errs...)
+}
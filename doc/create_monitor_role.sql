@@ -0,0 +1,47 @@
+--
+-- 创建greenplum_exporter使用的最小权限监控角色
+--
+-- 以gpadmin连接postgres库执行：
+--   psql -d postgres -f create_monitor_role.sql
+-- 执行前请修改下面的密码。不同版本中个别对象不存在时对应的GRANT语句会报错，可以忽略，
+-- exporter启动后会检查每个抓取器所需的权限，缺少的权限见greenplum_exporter_scraper_missing_privilege指标与日志。
+--
+
+CREATE ROLE greenplum_exporter WITH LOGIN NOSUPERUSER NOCREATEDB NOCREATEROLE INHERIT
+    PASSWORD 'changeme' CONNECTION LIMIT 5;
+
+GRANT CONNECT ON DATABASE postgres TO greenplum_exporter;
+
+-- 数据库大小、表膨胀、segment磁盘剩余空间、缺少统计信息的表、角色成员数、日志错误数
+GRANT USAGE ON SCHEMA gp_toolkit TO greenplum_exporter;
+GRANT SELECT ON gp_toolkit.gp_size_of_database TO greenplum_exporter;
+GRANT SELECT ON gp_toolkit.gp_bloat_diag TO greenplum_exporter;
+GRANT SELECT ON gp_toolkit.gp_disk_free TO greenplum_exporter;
+GRANT SELECT ON gp_toolkit.gp_stats_missing TO greenplum_exporter;
+GRANT SELECT ON gp_toolkit.gp_roles_assigned TO greenplum_exporter;
+GRANT SELECT ON gp_toolkit.gp_log_system TO greenplum_exporter;
+GRANT SELECT ON gp_toolkit.gp_log_database TO greenplum_exporter;
+
+-- 各segment上的参数值，供GUC、segment连接数与会话内存抓取器使用
+GRANT EXECUTE ON FUNCTION gp_toolkit.gp_param_setting(varchar) TO greenplum_exporter;
+
+-- 会话内存
+GRANT USAGE ON SCHEMA session_state TO greenplum_exporter;
+GRANT SELECT ON session_state.session_level_memory_consumption TO greenplum_exporter;
+
+-- Greenplum 7 / Cloudberry：pg_monitor包含pg_read_all_stats与pg_read_all_settings，
+-- 可以看到其他角色会话的状态与查询文本、pg_stat_statements中所有角色的语句，并可调用pg_ls_waldir读取WAL目录大小。
+-- Greenplum 5/6没有该角色，这些信息只有超级用户可见，非超级用户运行时相关抓取器只统计监控角色自己的会话。
+GRANT pg_monitor TO greenplum_exporter;
+
+-- 角色抓取器读取pg_authid中的密码与过期时间，该表只有超级用户可读，因此角色抓取器需要以超级用户运行。
+-- 授予SELECT权限会使监控角色能够读取密码摘要，不建议授予；collect.roles默认关闭，使用监控角色时不要开启即可：
+-- GRANT SELECT ON pg_catalog.pg_authid TO greenplum_exporter;
+
+-- 导入到数据库中的gpbackup备份历史表（--backup.history-table），按实际表名授权：
+-- GRANT SELECT ON public.gpbackup_history TO greenplum_exporter;
+
+-- gpperfmon库中的表默认属于gpmon，需要连接gpperfmon库执行：
+--   \c gpperfmon
+--   GRANT CONNECT ON DATABASE gpperfmon TO greenplum_exporter;
+--   GRANT SELECT ON system_now, diskspace_now, database_now, memory_info, queries_history TO greenplum_exporter;
@@ -1,10 +1,14 @@
 module greenplum-exporter
 
-go 1.14
+go 1.16
 
 require (
 	github.com/lib/pq v1.7.1
 	github.com/prometheus/client_golang v1.7.1
+	github.com/prometheus/client_model v0.2.0
 	github.com/prometheus/common v0.10.0
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
 	gopkg.in/alecthomas/kingpin.v2 v2.2.6
+	gopkg.in/yaml.v2 v2.3.0
+	modernc.org/sqlite v1.14.8
 )
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"greenplum-exporter/collector"
+	"html/template"
+	"net/http"
+	"time"
+
+	logger "github.com/prometheus/common/log"
+)
+
+/**
+ *  健康检查与首页
+ *  /-/healthy与/-/ready只读取采集器记录的状态，不访问数据库，避免探针频繁触发完整抓取；
+ *  /api/v1/health同样只汇总最近一次抓取的集群状态
+ */
+
+var landingTemplate = template.Must(template.New("landing").Parse(`<html>
+<head><title>Greenplum Exporter</title></head>
+<body>
+<h1>Greenplum Exporter</h1>
+<p><a href="{{.MetricPath}}">Metrics</a> | <a href="/-/healthy">Healthy</a> | <a href="/-/ready">Ready</a> | <a href="/api/v1/health">Cluster health</a></p>
+<p>Last successful connection check: {{if .LastConnected.IsZero}}never{{else}}{{.LastConnected.Format "2006-01-02 15:04:05"}}{{end}}</p>
+<table border="1" cellpadding="4">
+<tr><th>Scraper</th><th>Last scrape</th><th>Duration</th><th>Status</th></tr>
+{{range .Scrapers}}<tr>
+<td>{{.Name}}</td>
+<td>{{if .LastScrape.IsZero}}-{{else}}{{.LastScrape.Format "2006-01-02 15:04:05"}}{{end}}</td>
+<td>{{if .LastScrape.IsZero}}-{{else}}{{.Duration}}{{end}}</td>
+<td>{{if .Disabled}}disabled: {{.Disabled}}{{else if .LastScrape.IsZero}}not scraped yet{{else if .Error}}error: {{.Error}}{{else}}ok{{end}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+/**
+* 函数：healthyHandler
+* 功能：进程存活即返回200
+ */
+func healthyHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "Greenplum Exporter is Healthy.")
+}
+
+/**
+* 函数：newReadyHandler
+* 功能：最近一次成功检查数据库连接在window以内时返回200，否则返回503
+ */
+func newReadyHandler(c *collector.GreenPlumCollector, window time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lastConnected := c.LastConnected()
+
+		if lastConnected.IsZero() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, "Greenplum Exporter is not ready, database has never been connected.")
+			return
+		}
+
+		if time.Since(lastConnected) > window {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, "Greenplum Exporter is not ready, last successful connection check at %s.\n", lastConnected.Format(time.RFC3339))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, "Greenplum Exporter is Ready.")
+	}
+}
+
+// 集群健康状态对应的HTTP状态码
+var healthStatusCodes = map[string]int{
+	collector.HealthOK:       http.StatusOK,
+	collector.HealthDegraded: http.StatusTooManyRequests,
+	collector.HealthCritical: http.StatusServiceUnavailable,
+}
+
+/**
+* 函数：newHealthHandler
+* 功能：按规则汇总最近一次抓取的集群状态，以JSON返回，ok、degraded、critical分别对应200、429、503
+ */
+func newHealthHandler(rules map[string]string, maxAge time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := collector.EvaluateHealth(rules, maxAge)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(healthStatusCodes[report.Status])
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			logger.Errorf("encode health report failed, error:%v", err)
+		}
+	}
+}
+
+/**
+* 函数：newLandingHandler
+* 功能：首页列出启用的抓取器及其最近一次抓取的结果，并链接到指标路径
+ */
+func newLandingHandler(c *collector.GreenPlumCollector, metricPath string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		data := struct {
+			MetricPath    string
+			LastConnected time.Time
+			Scrapers      []collector.ScraperStatus
+		}{metricPath, c.LastConnected(), c.ScraperStatuses()}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := landingTemplate.Execute(w, data); err != nil {
+			logger.Errorf("render landing page failed, error:%v", err)
+		}
+	}
+}
+
+/**
+* 函数：checkConnectionPeriodically
+* 功能：定期检查数据库连接，使就绪状态不依赖于Prometheus的抓取频率
+ */
+func checkConnectionPeriodically(c *collector.GreenPlumCollector, interval time.Duration) {
+	check := func() {
+		if err := c.CheckConnection(); err != nil {
+			logger.Errorf("check database connection failed, error:%v", err)
+		}
+	}
+
+	check()
+	for range time.Tick(interval) {
+		check()
+	}
+}
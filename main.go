@@ -1,12 +1,17 @@
 package main
 
 import (
+	"fmt"
 	"greenplum-exporter/collector"
+	"greenplum-exporter/web"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	logger "github.com/prometheus/common/log"
+	"github.com/prometheus/common/model"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
@@ -20,23 +25,150 @@ var (
 	listenAddress         = kingpin.Flag("web.listen-address", "web endpoint").Default("0.0.0.0:9297").String()
 	metricPath            = kingpin.Flag("web.telemetry-path", "Path under which to expose metrics.").Default("/metrics").String()
 	disableDefaultMetrics = kingpin.Flag("disableDefaultMetrics", "do not report default metrics(go metrics and process metrics)").Default("true").Bool()
+	webConfigFile         = kingpin.Flag("web.config.file", "path to the config file enabling TLS, basic auth and bearer tokens, reloaded when changed").Default("").String()
+	webReadTimeout        = kingpin.Flag("web.read-timeout", "maximum duration for reading the entire request, 0 means no timeout").Default("30s").Duration()
+	webWriteTimeout       = kingpin.Flag("web.write-timeout", "maximum duration before timing out writes of the response, should be longer than a scrape, 0 means no timeout").Default("0s").Duration()
+	webReadyWindow        = kingpin.Flag("web.ready-window", "exporter is ready when the database connection was checked successfully within this window").Default("2m").Duration()
+	healthRules           = kingpin.Flag("health.rules", "comma separated rule=level overriding the level of cluster health rules, level is ok, degraded or critical").Default("").String()
+	healthMaxAge          = kingpin.Flag("health.max-age", "cluster health is stale when the last scrape is older than this").Default("5m").Duration()
+
+	collectBgWriter = kingpin.Flag("collect.bgwriter", "collect background writer and checkpoint statistics of master and each primary segment").Default("false").Bool()
+
+	collectAoStorage = kingpin.Flag("collect.ao-storage", "collect table storage type and append-optimized compression metrics of each database").Default("false").Bool()
+	aoStorageTopN    = kingpin.Flag("ao-storage.top-n", "number of largest append-optimized tables per database to report compression ratio for").Default("10").Int()
+	collectIndex     = kingpin.Flag("collect.index-usage", "collect index count, unused index and invalid index metrics of each database").Default("false").Bool()
+	indexTopN        = kingpin.Flag("index-usage.top-n", "number of largest unused indexes per database to report").Default("10").Int()
+
+	collectGpperfmon      = kingpin.Flag("collect.gpperfmon", "collect host, disk space, query count and dynamic memory metrics from the gpperfmon database").Default("false").Bool()
+	collectQueriesHistory = kingpin.Flag("collect.queries-history", "collect query duration, queue wait and cpu time histograms from gpperfmon queries_history").Default("false").Bool()
+
+	collectLogErrors = kingpin.Flag("collect.log-errors", "collect ERROR, FATAL and PANIC counters from the greenplum server log, reading the log views is expensive").Default("false").Bool()
+	logErrorsView    = kingpin.Flag("log-errors.view", "gp_toolkit log view to read, gp_log_system for the whole cluster or gp_log_database for the connected database only").Default("gp_log_system").Enum("gp_log_system", "gp_log_database")
+	logErrorsWindow  = kingpin.Flag("log-errors.window", "max time window of the server log to read back on each scrape").Default("5m").Duration()
+
+	collectBackup      = kingpin.Flag("collect.backup", "collect backup freshness metrics from gpbackup history").Default("false").Bool()
+	backupHistoryFile  = kingpin.Flag("backup.history-file", "path of the gpbackup_history.yaml or gpbackup_history.db file on the master host").Default("").String()
+	backupHistoryTable = kingpin.Flag("backup.history-table", "table holding the gpbackup history with the columns of the backups table in gpbackup_history.db, used instead of the history file").Default("").String()
+
+	collectMaintenance = kingpin.Flag("collect.maintenance", "collect analyze, vacuum and ddl staleness metrics of each database from pg_stat_last_operation").Default("false").Bool()
+	analyzeAgeBuckets  = kingpin.Flag("maintenance.analyze-age-buckets", "comma separated ages to count user tables not analyzed within").Default("1d,7d,30d").String()
+	ddlWindow          = kingpin.Flag("maintenance.ddl-window", "time window of recent ddl to count").Default("24h").Duration()
+
+	collectStatsMissing = kingpin.Flag("collect.stats-missing", "collect tables missing optimizer statistics of each database").Default("false").Bool()
+	statsMissingTopN    = kingpin.Flag("stats-missing.top-n", "number of tables per database with the most rows modified since last analyze to report").Default("10").Int()
+
+	collectSessionMemory = kingpin.Flag("collect.session-memory", "collect vmem usage of each segment and the sessions using the most memory from session_state").Default("false").Bool()
+	sessionMemoryTopN    = kingpin.Flag("session-memory.top-n", "number of sessions using the most memory to report").Default("10").Int()
+
+	collectPreparedXacts = kingpin.Flag("collect.prepared-xacts", "collect prepared transactions of each segment and distributed transactions of each state").Default("false").Bool()
+
+	collectWal = kingpin.Flag("collect.wal", "collect wal generation and archiving metrics of master and each segment").Default("false").Bool()
+
+	collectSegmentConnections = kingpin.Flag("collect.segment-connections", "collect backend count, max_connections and utilization of each segment and QE process count of sessions").Default("false").Bool()
+	segmentConnectionsTopN    = kingpin.Flag("segment-connections.top-n", "number of sessions with the most QE processes to report").Default("10").Int()
+
+	collectGuc = kingpin.Flag("collect.guc", "collect configuration parameter values of each segment and drift against master").Default("false").Bool()
+	gucNames   = kingpin.Flag("guc.names", "comma separated configuration parameters to check, parameters set differently on master by design should not be listed").Default("gp_vmem_protect_limit,statement_mem,max_statement_mem,gp_workfile_limit_per_segment,shared_buffers,work_mem").String()
+
+	collectRoles    = kingpin.Flag("collect.roles", "collect role inventory and security posture metrics (requires superuser)").Default("false").Bool()
+	rolesAllowed    = kingpin.Flag("roles.allowed", "comma separated roles allowed to be reported with per-role labels").Default("").String()
+	rolesExpiryDays = kingpin.Flag("roles.expiry-days", "report login roles whose password expires within this many days").Default("7").Int()
+
+	collectSessionBreakdown         = kingpin.Flag("collect.session-breakdown", "collect session counts by database, application name, state and waiting reason").Default("false").Bool()
+	sessionBreakdownMaxApplications = kingpin.Flag("session-breakdown.max-applications", "number of application names with the most sessions to keep, the rest are reported as other").Default("20").Int()
+
+	collectAsh  = kingpin.Flag("collect.ash", "sample active sessions in background and collect session seconds by wait state and top query fingerprints").Default("false").Bool()
+	ashInterval = kingpin.Flag("ash.interval", "interval between two samples of active sessions").Default("1s").Duration()
+	ashTopN     = kingpin.Flag("ash.top-n", "number of query fingerprints with the most sampled time to report").Default("10").Int()
+
+	collectStatements     = kingpin.Flag("collect.statements", "collect statistics of the top statements from pg_stat_statements").Default("false").Bool()
+	statementsTopN        = kingpin.Flag("statements.top-n", "number of statements with the most total time and with the most calls to report").Default("20").Int()
+	statementsQueryLength = kingpin.Flag("statements.query-length", "max length of the normalized query text in the info metric").Default("120").Int()
 )
 
-var scrapers = map[collector.Scraper]bool{
-	collector.NewClusterStateScraper():  true,
-	collector.NewSegmentScraper():       true,
-	collector.NewDatabaseSizeScraper():  true,
-	collector.NewLocksScraper():         true,
-	collector.NewConnectionsScraper():   true,
-	collector.NewMaxConnScraper():       true,
-	collector.NewConnDetailScraper():    true,
-	collector.NewUsersScraper():         false,
-	collector.NewBgWriterStateScraper(): false,
-
-	collector.NewSystemScraper():        false,
-	collector.NewQueryScraper():         false,
-	collector.NewDynamicMemoryScraper(): false,
-	collector.NewDiskScraper():          false,
+/**
+* 函数：newScrapers
+* 功能：在命令行参数解析完成后生成抓取器及其启用状态
+ */
+func newScrapers() map[collector.Scraper]bool {
+	return map[collector.Scraper]bool{
+		collector.NewClusterStateScraper():                                    true,
+		collector.NewConfigLoadTimeScraper():                                  true,
+		collector.NewSegmentScraper():                                         true,
+		collector.NewDatabaseSizeScraper():                                    true,
+		collector.NewLocksScraper():                                           true,
+		collector.NewConnectionsScraper():                                     true,
+		collector.NewMaxConnScraper():                                         true,
+		collector.NewConnDetailScraper():                                      true,
+		collector.NewRolesScraper(splitList(*rolesAllowed), *rolesExpiryDays): *collectRoles,
+		collector.NewBgWriterStateScraper():                                   *collectBgWriter,
+
+		collector.NewSystemScraper():         *collectGpperfmon,
+		collector.NewQueryScraper():          *collectGpperfmon,
+		collector.NewDynamicMemoryScraper():  *collectGpperfmon,
+		collector.NewDiskScraper():           *collectGpperfmon,
+		collector.NewQueriesHistoryScraper(): *collectQueriesHistory,
+
+		collector.NewAoStorageScraper(*aoStorageTopN): *collectAoStorage,
+		collector.NewIndexUsageScraper(*indexTopN):    *collectIndex,
+
+		collector.NewLogErrorsScraper(*logErrorsView, *logErrorsWindow):                     *collectLogErrors,
+		collector.NewBackupScraper(*backupHistoryFile, *backupHistoryTable):                 *collectBackup,
+		collector.NewMaintenanceScraper(mustParseDurations(*analyzeAgeBuckets), *ddlWindow): *collectMaintenance,
+		collector.NewStatsMissingScraper(*statsMissingTopN):                                 *collectStatsMissing,
+		collector.NewSessionMemoryScraper(*sessionMemoryTopN):                               *collectSessionMemory,
+		collector.NewPreparedXactsScraper():                                                 *collectPreparedXacts,
+		collector.NewWalScraper():                                                           *collectWal,
+		collector.NewSegmentConnectionsScraper(*segmentConnectionsTopN):                     *collectSegmentConnections,
+		collector.NewGucScraper(splitList(*gucNames)):                                       *collectGuc,
+		collector.NewSessionBreakdownScraper(*sessionBreakdownMaxApplications):              *collectSessionBreakdown,
+		collector.NewAshScraper(*ashInterval, *ashTopN):                                     *collectAsh,
+		collector.NewStatementsScraper(*statementsTopN, *statementsQueryLength):             *collectStatements,
+	}
+}
+
+/**
+* 函数：mustParseDurations
+* 功能：解析逗号分隔的时长列表，支持d、w、y等单位
+ */
+func mustParseDurations(s string) []time.Duration {
+	durations, err := parseDurations(s)
+	if err != nil {
+		kingpin.Fatalf("%v", err)
+	}
+
+	return durations
+}
+
+func parseDurations(s string) ([]time.Duration, error) {
+	durations := make([]time.Duration, 0)
+
+	for _, item := range splitList(s) {
+		d, err := model.ParseDuration(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration %q: %v", item, err)
+		}
+
+		durations = append(durations, time.Duration(d))
+	}
+
+	return durations, nil
+}
+
+/**
+* 函数：splitList
+* 功能：解析逗号分隔的列表，忽略空白项
+ */
+func splitList(s string) []string {
+	items := make([]string, 0)
+
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
 }
 
 var gathers prometheus.Gatherers
@@ -48,30 +180,84 @@ func main() {
 	logger.AddFlags(kingpin.CommandLine)
 	kingpin.Parse()
 
-	metricsHandleFunc := newHandler(*disableDefaultMetrics, scrapers)
+	if *collectAsh && *ashInterval <= 0 {
+		kingpin.Fatalf("--ash.interval must be positive")
+	}
+
+	// 数量参数用于切片或SQL的LIMIT，负数会使抓取出错
+	for name, value := range map[string]int{
+		"ao-storage.top-n":                   *aoStorageTopN,
+		"index-usage.top-n":                  *indexTopN,
+		"stats-missing.top-n":                *statsMissingTopN,
+		"session-memory.top-n":               *sessionMemoryTopN,
+		"segment-connections.top-n":          *segmentConnectionsTopN,
+		"session-breakdown.max-applications": *sessionBreakdownMaxApplications,
+		"ash.top-n":                          *ashTopN,
+		"statements.top-n":                   *statementsTopN,
+		"statements.query-length":            *statementsQueryLength,
+	} {
+		if value < 0 {
+			kingpin.Fatalf("--%s must not be negative", name)
+		}
+	}
+
+	if *webReadyWindow <= 0 {
+		kingpin.Fatalf("--web.ready-window must be positive")
+	}
+
+	rules, err := collector.ParseHealthRules(*healthRules)
+	if err != nil {
+		kingpin.Fatalf("invalid --health.rules: %v", err)
+	}
+
+	greenPlumCollector := collector.NewCollector(enabledScrapers(newScrapers()))
+
+	// 检查间隔取就绪窗口的三分之一，容忍两次检查失败
+	go checkConnectionPeriodically(greenPlumCollector, *webReadyWindow/3)
+
+	metricsHandleFunc := newHandler(*disableDefaultMetrics, greenPlumCollector)
 
 	mux := http.NewServeMux()
 
 	mux.HandleFunc(*metricPath, metricsHandleFunc)
+	mux.HandleFunc("/-/healthy", healthyHandler)
+	mux.HandleFunc("/-/ready", newReadyHandler(greenPlumCollector, *webReadyWindow))
+	mux.HandleFunc("/api/v1/health", newHealthHandler(rules, *healthMaxAge))
+	if *metricPath != "/" {
+		mux.HandleFunc("/", newLandingHandler(greenPlumCollector, *metricPath))
+	}
 
 	logger.Warnf("Greenplum exporter is starting and will listening on : %s", *listenAddress)
 
-	logger.Error(http.ListenAndServe(*listenAddress, mux).Error())
-}
-
-func newHandler(disableDefaultMetrics bool, scrapers map[collector.Scraper]bool) http.HandlerFunc {
+	server := &http.Server{
+		Addr:         *listenAddress,
+		Handler:      mux,
+		ReadTimeout:  *webReadTimeout,
+		WriteTimeout: *webWriteTimeout,
+	}
 
-	registry := prometheus.NewRegistry()
+	logger.Error(web.ListenAndServe(server, *webConfigFile, "/-/healthy", "/-/ready").Error())
+}
 
-	enabledScrapers := make([]collector.Scraper, 0, 16)
+/**
+* 函数：enabledScrapers
+* 功能：返回启用的抓取器
+ */
+func enabledScrapers(scrapers map[collector.Scraper]bool) []collector.Scraper {
+	enabled := make([]collector.Scraper, 0, 16)
 
 	for scraper, enable := range scrapers {
 		if enable {
-			enabledScrapers = append(enabledScrapers, scraper)
+			enabled = append(enabled, scraper)
 		}
 	}
 
-	greenPlumCollector := collector.NewCollector(enabledScrapers)
+	return enabled
+}
+
+func newHandler(disableDefaultMetrics bool, greenPlumCollector *collector.GreenPlumCollector) http.HandlerFunc {
+
+	registry := prometheus.NewRegistry()
 
 	registry.MustRegister(greenPlumCollector)
 
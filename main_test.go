@@ -0,0 +1,55 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseDurations(t *testing.T) {
+	tests := []struct {
+		s         string
+		durations []time.Duration
+		err       bool
+	}{
+		{s: "1d,7d,30d", durations: []time.Duration{24 * time.Hour, 7 * 24 * time.Hour, 30 * 24 * time.Hour}},
+		{s: " 12h , 1w ,", durations: []time.Duration{12 * time.Hour, 7 * 24 * time.Hour}},
+		{s: "1y", durations: []time.Duration{365 * 24 * time.Hour}},
+		{s: "", durations: []time.Duration{}},
+		{s: "1d,soon", err: true},
+		{s: "1.5h", err: true},
+		{s: "-1d", err: true},
+	}
+
+	for _, test := range tests {
+		durations, err := parseDurations(test.s)
+		if test.err {
+			if err == nil {
+				t.Errorf("parseDurations(%q) expected error", test.s)
+			}
+			continue
+		}
+
+		if err != nil || !reflect.DeepEqual(durations, test.durations) {
+			t.Errorf("parseDurations(%q) = %v, %v, want %v", test.s, durations, err, test.durations)
+		}
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		s     string
+		items []string
+	}{
+		{s: "gp_vmem_protect_limit,statement_mem", items: []string{"gp_vmem_protect_limit", "statement_mem"}},
+		{s: " a , ,b,", items: []string{"a", "b"}},
+		{s: "", items: []string{}},
+		{s: " , ", items: []string{}},
+	}
+
+	for _, test := range tests {
+		if items := splitList(test.s); !reflect.DeepEqual(items, test.items) {
+			t.Errorf("splitList(%q) = %v, want %v", test.s, items, test.items)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package web
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+/**
+ *  Web配置文件
+ *  配置HTTPS证书与客户端证书校验、bcrypt加密的basic auth用户以及bearer token，格式如下：
+ *
+ *  tls_server_config:
+ *    cert_file: server.crt
+ *    key_file: server.key
+ *    client_auth_type: RequireAndVerifyClientCert
+ *    client_ca_file: ca.crt
+ *  basic_auth_users:
+ *    prometheus: $2y$10$...
+ *  bearer_tokens:
+ *    - token
+ */
+
+type Config struct {
+	TLSConfig      *TLSConfig        `yaml:"tls_server_config"`
+	BasicAuthUsers map[string]string `yaml:"basic_auth_users"`
+	BearerTokens   []string          `yaml:"bearer_tokens"`
+}
+
+type TLSConfig struct {
+	CertFile       string `yaml:"cert_file"`
+	KeyFile        string `yaml:"key_file"`
+	ClientAuthType string `yaml:"client_auth_type"`
+	ClientCAFile   string `yaml:"client_ca_file"`
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"":                           tls.NoClientCert,
+	"NoClientCert":               tls.NoClientCert,
+	"RequestClientCert":          tls.RequestClientCert,
+	"RequireAnyClientCert":       tls.RequireAnyClientCert,
+	"VerifyClientCertIfGiven":    tls.VerifyClientCertIfGiven,
+	"RequireAndVerifyClientCert": tls.RequireAndVerifyClientCert,
+}
+
+/**
+* 函数：loadConfig
+* 功能：读取并校验Web配置文件，TLS配置中的证书同时被加载以尽早发现错误
+ */
+func loadConfig(path string) (*Config, *tls.Config, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	config := &Config{}
+	if err = yaml.UnmarshalStrict(content, config); err != nil {
+		return nil, nil, err
+	}
+
+	if config.TLSConfig == nil {
+		return config, nil, nil
+	}
+
+	tlsConfig, err := config.TLSConfig.build()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return config, tlsConfig, nil
+}
+
+/**
+* 函数：build
+* 功能：根据配置生成tls.Config
+ */
+func (c *TLSConfig) build() (*tls.Config, error) {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return nil, errors.New("cert_file and key_file are required in tls_server_config")
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	clientAuth, ok := clientAuthTypes[c.ClientAuthType]
+	if !ok {
+		return nil, fmt.Errorf("invalid client_auth_type: %s", c.ClientAuthType)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   clientAuth,
+	}
+
+	if c.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in client_ca_file: %s", c.ClientCAFile)
+		}
+
+		tlsConfig.ClientCAs = pool
+	} else if clientAuth == tls.VerifyClientCertIfGiven || clientAuth == tls.RequireAndVerifyClientCert {
+		return nil, errors.New("client_ca_file is required when client certificates are verified")
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,129 @@
+package web
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 在dir中生成自签名的证书与私钥，返回证书与私钥文件的路径
+func writeCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	writeFile(t, certFile, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+	writeFile(t, keyFile, string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})))
+
+	return certFile, keyFile
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeCertificate(t, dir)
+
+	tests := []struct {
+		name       string
+		content    string
+		err        string
+		tls        bool
+		clientAuth tls.ClientAuthType
+	}{
+		{name: "empty", content: ""},
+		{name: "auth only", content: "basic_auth_users:\n  prometheus: $2y$10$x\nbearer_tokens:\n  - abc\n"},
+		{name: "tls", content: "tls_server_config:\n  cert_file: " + certFile + "\n  key_file: " + keyFile + "\n", tls: true},
+		{
+			name:       "client certificates",
+			content:    "tls_server_config:\n  cert_file: " + certFile + "\n  key_file: " + keyFile + "\n  client_auth_type: RequireAndVerifyClientCert\n  client_ca_file: " + certFile + "\n",
+			tls:        true,
+			clientAuth: tls.RequireAndVerifyClientCert,
+		},
+		{name: "unknown field", content: "basic_auth_user:\n  prometheus: x\n", err: "not found"},
+		{name: "missing key file", content: "tls_server_config:\n  cert_file: " + certFile + "\n", err: "key_file are required"},
+		{name: "missing cert", content: "tls_server_config:\n  cert_file: " + filepath.Join(dir, "none.crt") + "\n  key_file: " + keyFile + "\n", err: "no such file"},
+		{
+			name:    "invalid client auth type",
+			content: "tls_server_config:\n  cert_file: " + certFile + "\n  key_file: " + keyFile + "\n  client_auth_type: Always\n",
+			err:     "invalid client_auth_type",
+		},
+		{
+			name:    "client ca required",
+			content: "tls_server_config:\n  cert_file: " + certFile + "\n  key_file: " + keyFile + "\n  client_auth_type: VerifyClientCertIfGiven\n",
+			err:     "client_ca_file is required",
+		},
+		{
+			name:    "client ca without certificates",
+			content: "tls_server_config:\n  cert_file: " + certFile + "\n  key_file: " + keyFile + "\n  client_ca_file: " + keyFile + "\n",
+			err:     "no certificate found",
+		},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(dir, "web.yml")
+		writeFile(t, path, test.content)
+
+		config, tlsConfig, err := loadConfig(path)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: loadConfig() error = %v, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+
+		if err != nil || config == nil {
+			t.Errorf("%s: loadConfig() error = %v", test.name, err)
+			continue
+		}
+
+		if (tlsConfig != nil) != test.tls {
+			t.Errorf("%s: loadConfig() tls = %v, want %v", test.name, tlsConfig != nil, test.tls)
+		} else if tlsConfig != nil && (tlsConfig.ClientAuth != test.clientAuth || len(tlsConfig.Certificates) != 1) {
+			t.Errorf("%s: loadConfig() client auth = %v, want %v", test.name, tlsConfig.ClientAuth, test.clientAuth)
+		}
+	}
+}
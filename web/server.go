@@ -0,0 +1,220 @@
+package web
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	logger "github.com/prometheus/common/log"
+	"golang.org/x/crypto/bcrypt"
+)
+
+/**
+ *  带TLS与认证的HTTP服务
+ *  Web配置文件修改后自动重新加载，证书、用户与token对新的连接和请求生效；
+ *  是否启用HTTPS由启动时的配置决定，运行中增删tls_server_config需要重启；
+ *  basic auth通过校验后缓存密码的摘要，避免每次抓取都执行耗时的bcrypt比较
+ */
+
+// 检查Web配置文件是否被修改的间隔
+const reloadInterval = 5 * time.Second
+
+// 用户不存在时与之比较的bcrypt摘要，成本为bcrypt.DefaultCost，使响应时间不暴露用户是否存在
+const dummyPasswordHash = "$2a$10$aq/QP7CtsflUh/2t8gWTAOr5LNMtMHBc09qNn2.dYmwAl9HVfRi/G"
+
+type webConfig struct {
+	path string
+
+	// 不需要认证的路径，如供容器编排探针访问的存活与就绪接口
+	publicPaths map[string]bool
+
+	mu        sync.RWMutex
+	modTime   time.Time
+	config    *Config
+	tlsConfig *tls.Config
+
+	// 用户名到最近一次校验通过的密码的SHA-256摘要，配置重新加载时清空
+	authCache map[string][sha256.Size]byte
+}
+
+/**
+* 函数：ListenAndServe
+* 功能：启动HTTP服务，configFile为空时与http.Server.ListenAndServe相同，publicPaths中的路径不需要认证
+ */
+func ListenAndServe(server *http.Server, configFile string, publicPaths ...string) error {
+	if configFile == "" {
+		return server.ListenAndServe()
+	}
+
+	c := &webConfig{path: configFile, publicPaths: make(map[string]bool, len(publicPaths))}
+	for _, path := range publicPaths {
+		c.publicPaths[path] = true
+	}
+
+	if err := c.reload(); err != nil {
+		return err
+	}
+
+	go c.watch()
+
+	server.Handler = c.authenticate(server.Handler)
+
+	c.mu.RLock()
+	useTLS := c.tlsConfig != nil
+	c.mu.RUnlock()
+
+	if !useTLS {
+		return server.ListenAndServe()
+	}
+
+	// Dockerfile使用的Go 1.16中，net/http只在设置了Certificates或GetCertificate时才不从文件加载证书，
+	// 因此同时设置GetCertificate，客户端证书校验的配置仍由GetConfigForClient提供
+	server.TLSConfig = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			c.mu.RLock()
+			defer c.mu.RUnlock()
+
+			return &c.tlsConfig.Certificates[0], nil
+		},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			c.mu.RLock()
+			defer c.mu.RUnlock()
+
+			return c.tlsConfig, nil
+		},
+	}
+
+	return server.ListenAndServeTLS("", "")
+}
+
+/**
+* 函数：reload
+* 功能：配置文件的修改时间变化时重新加载配置，加载失败时保留原配置
+ */
+func (c *webConfig) reload() error {
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return err
+	}
+
+	c.mu.RLock()
+	unchanged := info.ModTime().Equal(c.modTime)
+	c.mu.RUnlock()
+
+	if unchanged {
+		return nil
+	}
+
+	config, tlsConfig, err := loadConfig(c.path)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.config != nil && (c.tlsConfig == nil) != (tlsConfig == nil) {
+		logger.Warnf("adding or removing tls_server_config in %s requires restart", c.path)
+		tlsConfig = c.tlsConfig
+	}
+
+	c.modTime = info.ModTime()
+	c.config = config
+	c.tlsConfig = tlsConfig
+	c.authCache = make(map[string][sha256.Size]byte)
+
+	return nil
+}
+
+/**
+* 函数：watch
+* 功能：定期检查并重新加载Web配置文件
+ */
+func (c *webConfig) watch() {
+	for range time.Tick(reloadInterval) {
+		if err := c.reload(); err != nil {
+			logger.Errorf("reload web config file %s failed, keep using the previous config, error:%v", c.path, err)
+		}
+	}
+}
+
+/**
+* 函数：authenticate
+* 功能：未配置用户与token时不做认证，否则要求请求携带正确的basic auth用户密码或bearer token
+ */
+func (c *webConfig) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.mu.RLock()
+		config := c.config
+		c.mu.RUnlock()
+
+		if c.publicPaths[r.URL.Path] || len(config.BasicAuthUsers) == 0 && len(config.BearerTokens) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if user, password, ok := r.BasicAuth(); ok && c.checkPassword(config, user, password) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			token := []byte(strings.TrimPrefix(auth, "Bearer "))
+			for _, t := range config.BearerTokens {
+				if subtle.ConstantTimeCompare(token, []byte(t)) == 1 {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+
+		if len(config.BasicAuthUsers) > 0 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="greenplum-exporter"`)
+		}
+
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	})
+}
+
+/**
+* 函数：checkPassword
+* 功能：校验basic auth用户的密码，与该用户最近一次校验通过的密码相同时不再执行bcrypt比较；
+*      用户不存在时仍执行一次bcrypt比较，只缓存校验通过的结果
+ */
+func (c *webConfig) checkPassword(config *Config, user string, password string) bool {
+	hash, found := config.BasicAuthUsers[user]
+	if !found {
+		_ = bcrypt.CompareHashAndPassword([]byte(dummyPasswordHash), []byte(password))
+		return false
+	}
+
+	digest := sha256.Sum256([]byte(password))
+
+	c.mu.RLock()
+	cached, ok := c.authCache[user]
+	current := c.config == config
+	c.mu.RUnlock()
+
+	if ok && current && subtle.ConstantTimeCompare(cached[:], digest[:]) == 1 {
+		return true
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return false
+	}
+
+	// 配置已被重新加载时不写入缓存，避免旧配置中的密码在新配置下通过校验
+	c.mu.Lock()
+	if c.config == config {
+		c.authCache[user] = digest
+	}
+	c.mu.Unlock()
+
+	return true
+}
@@ -0,0 +1,154 @@
+package web
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthenticate(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{BasicAuthUsers: map[string]string{"prometheus": string(hash)}, BearerTokens: []string{"token"}}
+	c := &webConfig{config: config, publicPaths: map[string]bool{"/-/healthy": true}, authCache: make(map[string][32]byte)}
+	handler := c.authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name   string
+		path   string
+		user   string
+		pass   string
+		bearer string
+		status int
+	}{
+		{name: "no credentials", path: "/metrics", status: http.StatusUnauthorized},
+		{name: "basic auth", path: "/metrics", user: "prometheus", pass: "secret", status: http.StatusOK},
+		{name: "cached basic auth", path: "/metrics", user: "prometheus", pass: "secret", status: http.StatusOK},
+		{name: "wrong password after cached", path: "/metrics", user: "prometheus", pass: "wrong", status: http.StatusUnauthorized},
+		{name: "unknown user", path: "/metrics", user: "admin", pass: "secret", status: http.StatusUnauthorized},
+		{name: "bearer token", path: "/metrics", bearer: "token", status: http.StatusOK},
+		{name: "wrong bearer token", path: "/metrics", bearer: "tok", status: http.StatusUnauthorized},
+		{name: "public path", path: "/-/healthy", status: http.StatusOK},
+		{name: "public path prefix", path: "/-/healthy/x", status: http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", test.path, nil)
+		if test.user != "" {
+			r.SetBasicAuth(test.user, test.pass)
+		}
+		if test.bearer != "" {
+			r.Header.Set("Authorization", "Bearer "+test.bearer)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("%s: status = %d, want %d", test.name, w.Code, test.status)
+		}
+	}
+
+	if _, ok := c.authCache["prometheus"]; !ok {
+		t.Error("successful basic auth was not cached")
+	}
+
+	if _, ok := c.authCache["admin"]; ok || len(c.authCache) != 1 {
+		t.Errorf("failed basic auth was cached: %v", c.authCache)
+	}
+
+	// 重新加载配置后缓存失效，旧密码不能再通过校验
+	newHash, err := bcrypt.GenerateFromPassword([]byte("changed"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.config = &Config{BasicAuthUsers: map[string]string{"prometheus": string(newHash)}}
+	c.authCache = make(map[string][32]byte)
+	if c.checkPassword(c.config, "prometheus", "secret") || !c.checkPassword(c.config, "prometheus", "changed") {
+		t.Error("password cache is not reset after reloading the config")
+	}
+}
+
+func TestListenAndServeTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeCertificate(t, dir)
+	configFile := filepath.Join(dir, "web.yml")
+	writeFile(t, configFile, "tls_server_config:\n  cert_file: "+certFile+"\n  key_file: "+keyFile+"\nbearer_tokens:\n  - token\n")
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	server := &http.Server{Addr: addr, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+	errs := make(chan error, 1)
+	go func() { errs <- ListenAndServe(server, configFile, "/-/ready") }()
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	for i := 0; i < 50; i++ {
+		select {
+		case err = <-errs:
+			t.Fatalf("ListenAndServe() failed: %v", err)
+		default:
+		}
+
+		resp, err := client.Get("https://" + addr + "/-/ready")
+		if err != nil {
+			time.Sleep(20 * time.Millisecond)
+			continue
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK || resp.TLS == nil {
+			t.Fatalf("GET /-/ready over https = %d", resp.StatusCode)
+		}
+
+		resp, err = client.Get("https://" + addr + "/metrics")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("GET /metrics without token = %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+		}
+		return
+	}
+
+	t.Fatal("https server did not start")
+}
+
+func TestCheckPasswordUnknownUser(t *testing.T) {
+	// 用户不存在时与用户存在但密码错误时一样执行bcrypt比较
+	if cost, err := bcrypt.Cost([]byte(dummyPasswordHash)); err != nil || cost != bcrypt.DefaultCost {
+		t.Fatalf("dummy password hash cost = %d, %v, want %d", cost, err, bcrypt.DefaultCost)
+	}
+
+	c := &webConfig{config: &Config{BasicAuthUsers: map[string]string{}}, authCache: make(map[string][32]byte)}
+	if c.checkPassword(c.config, "admin", "secret") {
+		t.Error("unknown user passed the password check")
+	}
+
+	if len(c.authCache) != 0 {
+		t.Errorf("failed basic auth was cached: %v", c.authCache)
+	}
+}